@@ -0,0 +1,136 @@
+package mp3agic
+
+// Number of bits in the bit allocation of each subband of Layer II frames,
+// for the tables of ISO 11172-3 (B.2a to B.2d) and ISO 13818-3 (B.1).
+var layer2Nbal = [5][]int{
+	{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 2, 2, 2, 2},
+	{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 2, 2, 2, 2, 2, 2, 2},
+	{4, 4, 3, 3, 3, 3, 3, 3},
+	{4, 4, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3},
+	{4, 4, 4, 4, 3, 3, 3, 3, 3, 3, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2}}
+
+func layer2Table(f FrameHeader) []int {
+	if f.Version() != MPEG_VERSION_1_0 {
+		return layer2Nbal[4]
+	}
+	bitrate := f.BitrateInKbps() / f.Channels()
+	sampleRate := f.SampleRate()
+	switch {
+	case sampleRate == 48000 && bitrate >= 56 || bitrate >= 56 && bitrate <= 80:
+		return layer2Nbal[0]
+	case sampleRate != 48000 && bitrate >= 96:
+		return layer2Nbal[1]
+	case sampleRate != 32000 && bitrate <= 48:
+		return layer2Nbal[2]
+	}
+	return layer2Nbal[3]
+}
+
+// bitReader reads big-endian bit fields from a byte slice.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+func (r *bitReader) read(n int) (int, bool) {
+	if r.pos+n > len(r.data)*8 {
+		return 0, false
+	}
+	v := 0
+	for ; n > 0; n-- {
+		v = v<<1 | int(r.data[r.pos/8]>>(7-uint(r.pos%8))&1)
+		r.pos++
+	}
+	return v, true
+}
+
+// crcProtectedBits returns the number of bits following the CRC of the
+// frame that the CRC covers, given the frame data that follows the CRC.
+// It returns -1 if data is too short to tell.
+func crcProtectedBits(f FrameHeader, data []byte) int {
+	switch f.layer() {
+	case 3:
+		return f.SideInfoSize() * 8
+	case 1:
+		return -1
+	}
+
+	// Layer II: the bit allocation and scale factor selection information
+	nch := f.Channels()
+	bound := 32
+	if f.ChannelMode() == CHANNEL_MODE_JOINT_STEREO {
+		bound = (f.ModeExtension().Bits() + 1) * 4
+	}
+	nbal := layer2Table(f)
+	r := &bitReader{data: data}
+	scfsi := 0
+	for sb, n := range nbal {
+		channels := nch
+		if sb >= bound {
+			channels = 1 // the allocation is shared by both channels
+		}
+		for ch := 0; ch < channels; ch++ {
+			allocation, ok := r.read(n)
+			if !ok {
+				return -1
+			}
+			if allocation != 0 {
+				scfsi += 2 * (nch - channels + 1)
+			}
+		}
+	}
+	return r.pos + scfsi
+}
+
+// checkCrc verifies the CRC of a protected frame, whose data starts at
+// buf[0], and records a failure. false is returned if buf is too short for
+// the check, or if the frame can not be checked at all.
+func (f *File) checkCrc(frame *FrameHeader, buf []byte, offset int64) bool {
+	if !frame.Protection() || frame.layer() == 1 || frame.layer() == 2 && frame.FreeFormat() {
+		return true // nothing to check, or not supported
+	}
+	if len(buf) < 6 {
+		return false
+	}
+	bits := crcProtectedBits(*frame, buf[6:])
+	if bits < 0 || len(buf) < 6+(bits+7)/8 {
+		return false
+	}
+	crc := mpegCrc16(0xffff, buf[2:4], 16)
+	crc = mpegCrc16(crc, buf[6:], bits)
+	f.crcCheckedCount++
+	if crc != unpackUint16(buf[4:6]) {
+		f.crcFailures = append(f.crcFailures, offset)
+	}
+	return true
+}
+
+// mpegCrc16 updates crc with the first bits of data, using the CRC-16
+// (polynomial 0x8005) of protected MPEG frames.
+func mpegCrc16(crc uint16, data []byte, bits int) uint16 {
+	for i := 0; i < bits; i++ {
+		bit := uint16(data[i/8]>>(7-uint(i%8))) & 1
+		if crc>>15^bit != 0 {
+			crc = crc<<1 ^ 0x8005
+		} else {
+			crc <<= 1
+		}
+	}
+	return crc
+}
+
+// CrcCheckedCount returns the number of protected Layer II and III frames
+// whose CRC was checked.
+func (f *File) CrcCheckedCount() int {
+	return f.crcCheckedCount
+}
+
+// CrcFailureCount returns the number of frames whose CRC did not match.
+func (f *File) CrcFailureCount() int {
+	return len(f.crcFailures)
+}
+
+// CrcFailures returns the offsets of the frames whose CRC did not match.
+func (f *File) CrcFailures() []int64 {
+	return f.crcFailures
+}
@@ -0,0 +1,83 @@
+package mp3agic_test
+
+import (
+	"mp3agic"
+	. "testing"
+)
+
+func TestCrcOfUnprotectedFrames(t *T) {
+	file, err := loadMp3(t, "notags.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, 0, file.CrcCheckedCount(), "checked count")
+	assertEq(t, 0, file.CrcFailureCount(), "failure count")
+}
+
+func TestCrcOfLayer3Frames(t *T) {
+	for _, bufferLength := range []int{41, 256, 0} {
+		file, err := loadMp3(t, "crc.mp3", bufferLength)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		assertEq(t, 6, file.FrameCount(), "frame count", bufferLength)
+		assertEq(t, 6, file.CrcCheckedCount(), "checked count", bufferLength)
+		assertEq(t, 1, file.CrcFailureCount(), "failure count", bufferLength)
+		assertEq(t, []int64{0x85b}, file.CrcFailures(), "failures", bufferLength)
+	}
+}
+
+func TestCrcOfLayer2Frames(t *T) {
+	for _, bufferLength := range []int{41, 256, 0} {
+		file, err := loadMp3(t, "layer2crc.mp3", bufferLength)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		assertEq(t, 5, file.FrameCount(), "frame count", bufferLength)
+		assertEq(t, 5, file.CrcCheckedCount(), "checked count", bufferLength)
+		assertEq(t, []int64{2 * 417}, file.CrcFailures(), "failures", bufferLength)
+	}
+}
+
+func TestStreamCrcMatchesParse(t *T) {
+	for _, bufferLength := range []int{41, 256, 0} {
+		file, err := streamMp3(t, "crc.mp3", bufferLength)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		assertEq(t, 6, file.CrcCheckedCount(), "checked count", bufferLength)
+		assertEq(t, []int64{0x85b}, file.CrcFailures(), "failures", bufferLength)
+	}
+}
+
+// layer2Frames returns count stereo Layer II frames at 192 kbps, whose CRC
+// covers 39 bytes after the CRC.
+func layer2Frames(count int) []byte {
+	frame := make([]byte, 626)
+	for i := range frame {
+		frame[i] = 0xff
+	}
+	frame[1], frame[2], frame[3] = 0xfc, 0xa0, 0x00
+	frames := make([]byte, 0, count*len(frame))
+	for i := 0; i < count; i++ {
+		frames = append(frames, frame...)
+	}
+	return frames
+}
+
+func TestCrcOfFirstFrameAtEndOfBlock(t *T) {
+	for junk := 1; junk < 60; junk++ {
+		data := append(make([]byte, junk), layer2Frames(5)...)
+		file, err := mp3agic.Parse(BufReaderAt(data), int64(len(data)), &mp3agic.ParseOptions{BufferLength: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEq(t, int64(junk), file.StartOffset(), "start offset", junk)
+		assertEq(t, 5, file.FrameCount(), "frame count", junk)
+		assertEq(t, 5, file.CrcCheckedCount(), "checked count", junk)
+	}
+}
@@ -0,0 +1,173 @@
+package mp3agic
+
+import (
+	"fmt"
+	"io"
+	"mp3agic/id3v2"
+	"os"
+)
+
+const (
+	ISSUE_JUNK                = "Junk"
+	ISSUE_LOST_SYNC           = "Lost sync"
+	ISSUE_TRUNCATED_FRAME     = "Truncated frame"
+	ISSUE_INCONSISTENT_HEADER = "Inconsistent header"
+	ISSUE_DUPLICATE_TAG       = "Duplicate ID3v2 tag"
+)
+
+// StreamIssue is a damaged part of the MPEG stream, found when parsing
+// with ParseOptions.Diagnostics.
+type StreamIssue struct {
+	Kind    string // one of the ISSUE_* constants
+	Offset  int64
+	Length  int64  // number of bytes skipped up to the next valid frame
+	Message string // the error which revealed the issue, if any
+}
+
+func (issue StreamIssue) String() string {
+	s := fmt.Sprintf("%s at offset 0x%x", issue.Kind, issue.Offset)
+	if issue.Length > 0 {
+		s += fmt.Sprintf(" (%d bytes)", issue.Length)
+	}
+	if issue.Message != "" {
+		s += ": " + issue.Message
+	}
+	return s
+}
+
+// Issues returns the damaged parts of the stream, in stream order. They
+// are only searched for if ParseOptions.Diagnostics was set.
+func (f *File) Issues() []StreamIssue {
+	return f.issues
+}
+
+func (f *File) addIssue(kind string, offset, length int64, cause os.Error) {
+	issue := StreamIssue{Kind: kind, Offset: offset, Length: length}
+	if e, ok := cause.(*InvalidDataError); ok {
+		issue.Message = e.Message // the offset is part of the issue
+	} else if cause != nil {
+		issue.Message = cause.String()
+	}
+	f.issues = append(f.issues, issue)
+}
+
+// skipDuplicateTags reports and skips the ID3v2 tags which directly follow
+// the first one, ending at offset, and returns the offset after them.
+func (f *File) skipDuplicateTags(r io.ReaderAt, offset int64) int64 {
+	for {
+		header, err := id3v2.ExtractTagHeader(io.NewSectionReader(r, offset, f.length-offset))
+		if err != nil {
+			break
+		}
+		length := int64(header.TagLength())
+		f.addIssue(ISSUE_DUPLICATE_TAG, offset, length, nil)
+		offset += length
+	}
+	return offset
+}
+
+// skipDamage reports the damaged region starting with the invalid frame
+// at offset, where scanning stopped with the error cause, and returns the
+// offset of the next valid frame, or -1 if there is none.
+func (f *File) skipDamage(r io.ReaderAt, offset int64, cause os.Error, bufferLength int) (int64, os.Error) {
+	if offset >= f.maxEndOffset() {
+		return -1, nil // reached the ID3v1 tag
+	}
+	kind := ISSUE_INCONSISTENT_HEADER
+	frame, err := readFrameHeader(r, offset)
+	switch {
+	case err != nil:
+		kind = ISSUE_LOST_SYNC
+	case offset+int64(f.FrameLength(frame)) > f.Length():
+		f.addIssue(ISSUE_TRUNCATED_FRAME, offset, f.Length()-offset, cause)
+		return -1, nil
+	}
+
+	next, err := f.findSync(r, offset+1, bufferLength)
+	if err != nil {
+		return 0, err
+	}
+	end := next
+	if next < 0 {
+		end = f.maxEndOffset()
+	}
+	f.addIssue(kind, offset, end-offset, cause)
+	return next, nil
+}
+
+// findSync returns the offset of the first frame, at or after the given
+// offset, which is consistent with the frames found so far and followed by
+// another frame header or by the end of the audio data; -1 is returned if
+// there is none.
+func (f *File) findSync(r io.ReaderAt, offset int64, bufferLength int) (int64, os.Error) {
+	buf := make([]byte, bufferLength)
+	end := f.maxEndOffset()
+	for offset+4 <= end {
+		readn, err := r.ReadAt(buf, offset)
+		if err != nil && err != os.EOF {
+			return 0, err
+		}
+		if int64(readn) > end-offset {
+			readn = int(end - offset)
+		}
+		if readn < 4 {
+			break
+		}
+		for i := 0; i+4 <= readn; i++ {
+			if buf[i] == 0xff && buf[i+1]&0xe0 == 0xe0 && f.validFrameAt(r, offset+int64(i), end) {
+				return offset + int64(i), nil
+			}
+		}
+		offset += int64(readn - 3)
+	}
+	return -1, nil
+}
+
+func (f *File) validFrameAt(r io.ReaderAt, offset int64, end int64) bool {
+	frame, err := readFrameHeader(r, offset)
+	if err != nil || f.sanityCheckFrame(frame, offset) != nil {
+		return false
+	}
+	next := offset + int64(f.FrameLength(frame))
+	if next >= end {
+		return next == end
+	}
+	_, err = readFrameHeader(r, next)
+	return err == nil
+}
+
+// checkEnds reports junk between the start of the scan and the first
+// frame, and a truncated frame after the last one.
+func (f *File) checkEnds(r io.ReaderAt, offset int64) {
+	first := f.firstFrameOffset()
+	if first > offset {
+		i := 0
+		for i < len(f.issues) && f.issues[i].Offset < offset {
+			i++
+		}
+		junk := StreamIssue{Kind: ISSUE_JUNK, Offset: offset, Length: first - offset}
+		f.issues = append(f.issues[:i], append([]StreamIssue{junk}, f.issues[i:]...)...)
+	}
+
+	if n := len(f.issues); f.endOffset < f.startOffset || n > 0 && f.issues[n-1].Kind == ISSUE_TRUNCATED_FRAME {
+		return
+	}
+	next := f.endOffset + 1
+	end := f.maxEndOffset()
+	frame, err := readFrameHeader(r, next)
+	if err == nil && f.sanityCheckFrame(frame, next) == nil && next+int64(f.FrameLength(frame)) > end {
+		f.addIssue(ISSUE_TRUNCATED_FRAME, next, end-next, nil)
+	}
+}
+
+func readFrameHeader(r io.ReaderAt, offset int64) (*FrameHeader, os.Error) {
+	var head [4]byte
+	readn, err := r.ReadAt(head[:], offset)
+	if readn < len(head) {
+		if err == nil {
+			err = os.EOF
+		}
+		return nil, err
+	}
+	return NewFrameHeader(head[:])
+}
@@ -0,0 +1,86 @@
+package mp3agic_test
+
+import (
+	"io/ioutil"
+	"mp3agic"
+	. "testing"
+)
+
+func loadMp3WithDiagnostics(t *T, filename string, bufferLength int) *mp3agic.File {
+	file, err := mp3agic.ParseFile(RES_DIR+filename, &mp3agic.ParseOptions{BufferLength: bufferLength, Diagnostics: true})
+	if err != nil {
+		t.Fatal(filename, err)
+	}
+	return file
+}
+
+func assertIssue(t *T, expected mp3agic.StreamIssue, issue mp3agic.StreamIssue, msg ...interface{}) {
+	assertEq(t, expected.Kind, issue.Kind, append(msg, "kind")...)
+	assertEq(t, expected.Offset, issue.Offset, append(msg, "offset")...)
+	assertEq(t, expected.Length, issue.Length, append(msg, "length")...)
+}
+
+func TestDiagnosticsOfHealthyFile(t *T) {
+	for _, filename := range []string{"notags.mp3", "v1andv23tags.mp3", "vbri.mp3"} {
+		file := loadMp3WithDiagnostics(t, filename, 0)
+		assertEq(t, 0, len(file.Issues()), filename, "issues")
+	}
+}
+
+func TestDiagnosticsSkipsDamagedFrames(t *T) {
+	for _, bufferLength := range []int{41, 256, 0} {
+		file := loadMp3WithDiagnostics(t, "damaged.mp3", bufferLength)
+		assertEq(t, int64(0x1a1), file.StartOffset(), "start offset", bufferLength)
+		assertEq(t, int64(0xb98), file.EndOffset(), "end offset", bufferLength)
+		assertEq(t, 5, file.FrameCount(), "frame count", bufferLength)
+		expected := []mp3agic.StreamIssue{
+			{Kind: mp3agic.ISSUE_LOST_SYNC, Offset: 0x722, Length: 100},
+			{Kind: mp3agic.ISSUE_INCONSISTENT_HEADER, Offset: 0x8bf, Length: 626}}
+		issues := file.Issues()
+		assertEq(t, len(expected), len(issues), "issues", bufferLength)
+		for i := 0; i < len(expected) && i < len(issues); i++ {
+			assertIssue(t, expected[i], issues[i], bufferLength, i)
+			assert(t, issues[i].Message != "", "cause expected", bufferLength, i)
+		}
+	}
+}
+
+func TestDiagnosticsWithoutOptionStopsAtDamage(t *T) {
+	file, err := loadMp3(t, "damaged.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, 3, file.FrameCount(), "frame count")
+	assertEq(t, int64(0x721), file.EndOffset(), "end offset")
+	assert(t, file.Issues() == nil, "issues should be nil")
+}
+
+func TestDiagnosticsReportsTruncatedFrame(t *T) {
+	file := loadMp3WithDiagnostics(t, "incompletempegframe.mp3", 256)
+	assertEq(t, 5, file.FrameCount(), "frame count")
+	issues := file.Issues()
+	assertEq(t, 1, len(issues), "issues")
+	if len(issues) == 1 {
+		assertIssue(t, mp3agic.StreamIssue{Kind: mp3agic.ISSUE_TRUNCATED_FRAME, Offset: 0xf18, Length: 103}, issues[0])
+	}
+}
+
+func TestDiagnosticsReportsLeadingJunk(t *T) {
+	data, err := ioutil.ReadFile(RES_DIR + "notags.mp3")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	data = append([]byte("JUNKJUNKJUNK"), data...)
+	file, err := mp3agic.Parse(BufReaderAt(data), int64(len(data)), &mp3agic.ParseOptions{Diagnostics: true})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	issues := file.Issues()
+	assertEq(t, 1, len(issues), "issues")
+	if len(issues) == 1 {
+		assertIssue(t, mp3agic.StreamIssue{Kind: mp3agic.ISSUE_JUNK, Offset: 0, Length: 12}, issues[0])
+	}
+}
@@ -0,0 +1,36 @@
+package mp3agic
+
+import (
+	"fmt"
+	"mp3agic/id3v2"
+	"os"
+)
+
+// InvalidDataError reports MPEG audio data which cannot be decoded.
+type InvalidDataError struct {
+	Offset  int64 // in the stream, -1 if not known
+	Message string
+}
+
+func (e *InvalidDataError) String() string {
+	if e.Offset < 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s at offset 0x%x", e.Message, e.Offset)
+}
+
+// Warnings returns the errors met while reading the tags and the VBR
+// header of the stream, which did not prevent parsing it. Missing tags are
+// not reported.
+func (f *File) Warnings() []os.Error {
+	return f.warnings
+}
+
+// addWarning records err, unless it only tells that there is no tag.
+func (f *File) addWarning(err os.Error) {
+	switch err.(type) {
+	case nil, *id3v2.NoSuchTagError:
+		return
+	}
+	f.warnings = append(f.warnings, err)
+}
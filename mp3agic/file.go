@@ -4,131 +4,257 @@ import (
 	"io"
 	"mp3agic/id3v2"
 	"os"
+	"strings"
 )
 
 type File struct {
-	id3v1tag      *Id3v1Tag
-	id3v2tag      *id3v2.Tag
-	startOffset   int64
-	endOffset     int64
-	length        int64
-	frameCount    int
-	xingOffset    int64
-	bitrates      map[int]int
-	bitrate       float64
-	xingBitrate   int
-	channelMode   string
-	emphasis      string
-	layer         string
-	modeExtension string
-	sampleRate    uint32
-	version       string
-	copyrighted   bool
-	original      bool
-	customTag     []byte
+	filename        string
+	id3v1tag        *Id3v1Tag
+	id3v2tag        *id3v2.Tag
+	startOffset     int64
+	endOffset       int64
+	length          int64
+	scanLimit       int64
+	frameCount      int
+	indexFrames     bool
+	frames          []MpegFrame
+	diagnostics     bool
+	issues          []StreamIssue
+	crcCheckedCount int
+	crcFailures     []int64
+	xingOffset      int64
+	xingHeader      *XingHeader
+	vbriHeader      *VbriHeader
+	lameTag         *LameTag
+	bitrates        map[int]int
+	bitrate         float64
+	xingBitrate     int
+	channelMode     ChannelMode
+	emphasis        Emphasis
+	layer           MpegLayer
+	modeExtension   ModeExtension
+	sampleRate      uint32
+	samplesPerFrame int
+	freeFormatSlots int
+	version         MpegVersion
+	copyrighted     bool
+	original        bool
+	customTag       []byte
+	warnings        []os.Error
 }
 
 const (
 	DEFAULT_BUFFER_LENGTH = 65536
 	MINIMUM_BUFFER_LENGTH = 40
+	MAXIMUM_FREE_BITRATE  = 640 // kbps, for measuring free format frames
+
+	// MAXIMUM_STREAM_TAIL_LENGTH bounds what ParseStream keeps of the
+	// data following the MPEG frames, for the custom tag.
+	MAXIMUM_STREAM_TAIL_LENGTH = 65536
 )
 
-// FIXME: use some minimal interface instead of os.File in the argument
-// TODO: verify if errors handling (and ignoring) is ok
-func ParseFile(raw *os.File, bufferLength int) (*File, os.Error) {
-	if bufferLength == 0 {
-		bufferLength = DEFAULT_BUFFER_LENGTH
+const (
+	GAPLESS_INFO_NONE     = "None"
+	GAPLESS_INFO_LAME     = "LAME tag"
+	GAPLESS_INFO_ITUNSMPB = "iTunSMPB"
+)
+
+// ParseOptions tune how an MP3 stream is parsed. A nil *ParseOptions
+// selects the defaults.
+type ParseOptions struct {
+	// BufferLength is the size of the blocks in which MPEG frames are
+	// scanned; 0 means DEFAULT_BUFFER_LENGTH.
+	BufferLength int
+
+	// VerifyMusicCrc makes Parse read all audio data to check it against
+	// the music CRC of the LAME tag. It is ignored by ParseStream.
+	VerifyMusicCrc bool
+
+	// IndexFrames keeps a record of every audio frame, see File.Frames.
+	IndexFrames bool
+
+	// Diagnostics makes Parse scan past damaged parts of the stream
+	// instead of stopping at the first one, and report them, see
+	// File.Issues. It is ignored by ParseStream.
+	Diagnostics bool
+}
+
+func (opts *ParseOptions) indexFrames() bool {
+	return opts != nil && opts.IndexFrames
+}
+
+func (opts *ParseOptions) bufferLength() int {
+	if opts == nil || opts.BufferLength == 0 {
+		return DEFAULT_BUFFER_LENGTH
+	}
+	return opts.BufferLength
+}
+
+// ParseFile opens the named file and parses it with Parse. The file is
+// read in blocks of opts.BufferLength bytes. Damaged tags do not make it
+// fail, see File.Warnings.
+func ParseFile(filename string, opts *ParseOptions) (*File, os.Error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.Open(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer raw.Close()
+
+	mp3file, err := Parse(raw, stat.Size, opts)
+	if err != nil {
+		return nil, err
+	}
+	mp3file.filename = filename
+	return mp3file, nil
+}
+
+// Parse scans the first size bytes of r for ID3 tags and MPEG audio
+// frames. The data may come from a file, from memory or from any other
+// random-access source. An *InvalidDataError is returned if no MPEG
+// frames are found; errors in the tags are recorded, see File.Warnings.
+func Parse(r io.ReaderAt, size int64, opts *ParseOptions) (*File, os.Error) {
+	bufferLength := opts.bufferLength()
+	if bufferLength <= MINIMUM_BUFFER_LENGTH {
+		return nil, os.NewError("Buffer too small")
 	}
 	mp3file := &File{
+		length:      size,
 		startOffset: -1,
 		endOffset:   -1,
 		xingOffset:  -1,
+		indexFrames: opts.indexFrames(),
+		diagnostics: opts != nil && opts.Diagnostics,
 		bitrates:    make(map[int]int)}
-	mp3file.calcLength(raw)
-	// TODO: try to move all Seek()s into this function
 
-	mp3file.id3v1tag, _ = ExtractId3v1Tag(raw)
+	var err os.Error
+	mp3file.id3v1tag, err = ExtractId3v1Tag(r, size)
+	mp3file.addWarning(err)
 
 	offset := int64(0)
-	id3v2tagHeader, _ := id3v2.ExtractTagHeader(raw)
+	id3v2tagHeader, id3v2err := id3v2.ExtractTagHeader(r)
 	if id3v2tagHeader != nil {
-		offset = int64(len(id3v2tagHeader)) + int64(id3v2tagHeader.DataLength())
+		offset = int64(id3v2tagHeader.TagLength())
+	}
+	if mp3file.diagnostics {
+		offset = mp3file.skipDuplicateTags(r, offset)
 	}
 
-	err := mp3file.scanFile(raw, offset, bufferLength)
+	err = mp3file.scanFile(r, offset, bufferLength)
 	if err != nil {
 		return nil, err
 	}
 	if mp3file.startOffset < 0 {
-		return nil, os.NewError("No mpegs frames found")
+		return nil, &InvalidDataError{-1, "No mpegs frames found"}
+	}
+	if mp3file.diagnostics {
+		mp3file.checkEnds(r, offset)
+	}
+	if mp3file.xingOffset >= 0 {
+		mp3file.addWarning(mp3file.extractVbrHeader(r))
+	}
+	if mp3file.lameTag != nil && opts != nil && opts.VerifyMusicCrc {
+		err = mp3file.verifyMusicCrc(r, bufferLength)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if id3v2tagHeader != nil {
+		mp3file.id3v2tag, id3v2err = id3v2.ExtractTag(r)
 	}
-	mp3file.id3v2tag, _ = id3v2.ExtractTag(raw)
-	mp3file.extractCustomTag(raw)
+	mp3file.addWarning(id3v2err)
+	mp3file.addWarning(mp3file.extractCustomTag(r))
 
 	return mp3file, nil
 }
 
-// TODO: handle Seek() errors
-func (f *File) calcLength(stream io.Seeker) {
-	offset, _ := stream.Seek(0, 1) // remember current position
-	length, _ := stream.Seek(0, 2)
-	_, _ = stream.Seek(offset, 0)
-	f.length = length
-}
-
 func (f *File) Length() int64 {
 	return f.length
 }
 
-// FIXME: handle Seek() errors
-func (f *File) scanFile(raw *os.File, offset int64, bufferLength int) os.Error {
-	var err os.Error
-	raw.Seek(offset, 0)
-
+func (f *File) scanFile(r io.ReaderAt, offset int64, bufferLength int) os.Error {
 	buf := make([]byte, bufferLength)
 
-	lastOffset := offset
 	for lastBlock := false; !lastBlock; {
-		readn, _ := raw.Read(buf[:]) // FIXME: handle error code
+		readn, err := r.ReadAt(buf, offset)
+		if err != nil && err != os.EOF {
+			return err
+		}
 		if readn < len(buf) {
-			lastBlock = true // FIXME: Java; might not be true in Go (rather check for: 0, os.EOF)
+			lastBlock = true
 		}
-		if readn < MINIMUM_BUFFER_LENGTH { // FIXME: data can be lost???
+		if readn < MINIMUM_BUFFER_LENGTH {
 			continue
 		}
 
-		tmpOffset := 0
-		if f.startOffset < 0 {
-			tmpOffset = f.scanBlockForStart(buf, readn, offset, tmpOffset)
-			lastOffset = f.startOffset
-		}
-		tmpOffset, err = f.scanBlock(buf, readn, offset, tmpOffset)
-
+		next, err := f.scanStep(r, buf[:readn], readn, offset)
 		if err == nil {
-			offset += int64(tmpOffset)
-			raw.Seek(offset, 0)
+			if next == offset {
+				return nil // no more frames fit before maxEndOffset()
+			}
+			offset = next
+			continue
 		}
 
-		if err != nil { // in Java mp3agic was: "catch(InvalidDataException)"
-			if f.frameCount < 2 {
-				f.startOffset = -1
-				f.xingOffset = -1
-				f.frameCount = 0
-				f.bitrates = make(map[int]int)
-				lastBlock = false
-				offset = lastOffset + 1
-				if offset == 0 {
-					return os.NewError("Valid start of mpeg frames not found:" + err.String())
-				}
-				raw.Seek(offset, 0)
+		// in Java mp3agic was: "catch(InvalidDataException)"
+		if f.frameCount >= 2 {
+			if !f.diagnostics {
+				return nil
 			}
-			return nil
+			offset, err = f.skipDamage(r, next, err, bufferLength)
+			if err != nil || offset < 0 {
+				return err
+			}
+			lastBlock = false
+			continue
 		}
+		offset, err = f.resync(err)
+		if err != nil {
+			return err
+		}
+		lastBlock = false
 	}
 	return nil
 }
 
-func (f *File) scanBlockForStart(buf []byte, readn int, offset int64, tmpOffset int) int {
+// scanStep scans readn bytes of buf, found at the given offset in the
+// stream, and returns the offset at which scanning should continue, or
+// the offset of the invalid frame on error.
+func (f *File) scanStep(r io.ReaderAt, buf []byte, readn int, offset int64) (int64, os.Error) {
+	tmpOffset := 0
+	if f.startOffset < 0 {
+		tmpOffset = f.scanBlockForStart(r, buf, readn, offset, tmpOffset)
+	}
+	tmpOffset, err := f.scanBlock(buf, readn, offset, tmpOffset)
+	return offset + int64(tmpOffset), err
+}
+
+// resync forgets the frames found so far, after scanning stumbled on
+// invalid data too early, and returns the offset at which the search for
+// the start of MPEG frames should be retried.
+func (f *File) resync(cause os.Error) (int64, os.Error) {
+	offset := f.startOffset + 1
+	f.startOffset = -1
+	f.xingOffset = -1
+	f.xingHeader = nil
+	f.vbriHeader = nil
+	f.lameTag = nil
+	f.frameCount = 0
+	f.frames = nil
+	f.freeFormatSlots = 0
+	f.crcCheckedCount = 0
+	f.crcFailures = nil
+	f.bitrates = make(map[int]int)
+	if offset == 0 {
+		return 0, &InvalidDataError{-1, "Valid start of mpeg frames not found: " + cause.String()}
+	}
+	return offset, nil
+}
+
+func (f *File) scanBlockForStart(r io.ReaderAt, buf []byte, readn int, offset int64, tmpOffset int) int {
 	for tmpOffset < readn-MINIMUM_BUFFER_LENGTH {
 		if buf[tmpOffset] != 0xff || buf[tmpOffset+1]&0xe0 != 0xe0 {
 			tmpOffset++
@@ -140,11 +266,15 @@ func (f *File) scanBlockForStart(buf []byte, readn int, offset int64, tmpOffset
 			tmpOffset++
 			continue
 		}
+		if frame.FreeFormat() && f.freeFormatSlots == 0 && !f.measureFreeFormat(frame, r, offset+int64(tmpOffset), buf[tmpOffset:readn]) {
+			tmpOffset++
+			continue
+		}
 
-		if f.xingOffset < 0 && HasXingFrameTag(buf[tmpOffset:]) {
+		if f.xingOffset < 0 && (HasXingFrameTag(buf[tmpOffset:readn]) || HasVbriFrameTag(buf[tmpOffset:readn])) {
 			f.xingOffset = offset + int64(tmpOffset)
-			f.xingBitrate = frame.BitrateInKbps()
-			tmpOffset += frame.LengthInBytes()
+			f.xingBitrate = f.frameBitrate(frame)
+			tmpOffset += f.FrameLength(frame)
 			continue
 		}
 
@@ -154,12 +284,17 @@ func (f *File) scanBlockForStart(buf []byte, readn int, offset int64, tmpOffset
 		f.layer = frame.Layer()
 		f.modeExtension = frame.ModeExtension()
 		f.sampleRate = frame.SampleRate()
+		f.samplesPerFrame = frame.SamplesPerFrame()
 		f.version = frame.Version()
 		f.copyrighted = frame.Copyrighted()
 		f.original = frame.Original()
+		if !f.checkCrc(frame, buf[tmpOffset:], f.startOffset) && tmpOffset > 0 {
+			break // scanBlock counts it, from the start of the next block
+		}
 		f.frameCount++
-		f.addBitrate(frame.BitrateInKbps())
-		tmpOffset += frame.LengthInBytes()
+		f.addBitrate(f.frameBitrate(frame))
+		f.indexFrame(frame, buf[tmpOffset:], f.startOffset)
+		tmpOffset += f.FrameLength(frame)
 		break
 	}
 	return tmpOffset
@@ -169,25 +304,29 @@ func (f *File) scanBlock(buf []byte, readn int, offset int64, tmpOffset int) (in
 	for tmpOffset < readn-MINIMUM_BUFFER_LENGTH {
 		frame, err := NewFrameHeader(buf[tmpOffset : tmpOffset+4])
 		if err != nil {
-			return 0, os.NewError("Could not decode MPEG frame: " + err.String())
+			return tmpOffset, &InvalidDataError{offset + int64(tmpOffset), "Could not decode MPEG frame: " + err.String()}
 		}
 		err = f.sanityCheckFrame(frame, offset+int64(tmpOffset))
 		if err != nil {
-			return 0, err
+			return tmpOffset, err
 		}
-		newEndOffset := offset + int64(tmpOffset) + int64(frame.LengthInBytes()) - 1
+		newEndOffset := offset + int64(tmpOffset) + int64(f.FrameLength(frame)) - 1
 		if newEndOffset >= f.maxEndOffset() {
 			break
 		}
+		if !f.checkCrc(frame, buf[tmpOffset:], offset+int64(tmpOffset)) && tmpOffset > 0 {
+			break // check the frame at the start of the next block
+		}
 		f.endOffset = newEndOffset
 		f.frameCount++
-		f.addBitrate(frame.BitrateInKbps())
-		tmpOffset += frame.LengthInBytes()
+		f.addBitrate(f.frameBitrate(frame))
+		f.indexFrame(frame, buf[tmpOffset:], offset+int64(tmpOffset))
+		tmpOffset += f.FrameLength(frame)
 	}
 	return tmpOffset, nil
 }
 
-func (f *File) extractCustomTag(stream io.ReadSeeker) os.Error {
+func (f *File) extractCustomTag(r io.ReaderAt) os.Error {
 	bufferLength := int(f.Length() - (f.endOffset + 1))
 	if f.HasId3v1Tag() {
 		bufferLength -= Id3v1_length
@@ -198,35 +337,139 @@ func (f *File) extractCustomTag(stream io.ReadSeeker) os.Error {
 	}
 
 	customTag := make([]byte, bufferLength)
-	stream.Seek(f.endOffset+1, 0)
-	readn, err := stream.Read(customTag)
-	if err != nil {
-		return os.NewError("Reading custom tag: " + err.String())
-	}
+	readn, err := r.ReadAt(customTag, f.endOffset+1)
 	if readn < len(customTag) {
-		return os.NewError("Reading custom tag: Not enough bytes read")
+		if err != nil {
+			return os.NewError("Reading custom tag: " + err.String())
+		}
+		return &InvalidDataError{f.endOffset + 1, "Reading custom tag: Not enough bytes read"}
 	}
 	f.customTag = customTag
 	return nil
 }
 
+// extractVbrHeader decodes the Xing or VBRI header from the frame at
+// xingOffset. os.EOF is returned if r does not hold the whole frame, an
+// *InvalidDataError if the header is damaged.
+func (f *File) extractVbrHeader(r io.ReaderAt) os.Error {
+	var head [4]byte
+	readn, _ := r.ReadAt(head[:], f.xingOffset)
+	if readn < len(head) {
+		return os.EOF
+	}
+	frame, err := NewFrameHeader(head[:])
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, f.FrameLength(frame))
+	readn, _ = r.ReadAt(buf, f.xingOffset)
+	if readn < len(buf) {
+		return os.EOF
+	}
+	if HasVbriFrameTag(buf) {
+		f.vbriHeader, err = NewVbriHeader(buf)
+	} else {
+		f.xingHeader, err = NewXingHeader(buf)
+	}
+	if err != nil {
+		return &InvalidDataError{f.xingOffset, err.String()}
+	}
+	if f.vbriHeader != nil {
+		return nil
+	}
+	f.lameTag, _ = NewLameTag(buf, f.xingHeader)
+	return nil
+}
+
+func (f *File) verifyMusicCrc(r io.ReaderAt, bufferLength int) os.Error {
+	var head [4]byte
+	r.ReadAt(head[:], f.xingOffset)
+	frame, err := NewFrameHeader(head[:])
+	if err != nil {
+		return err
+	}
+	return f.lameTag.verifyMusicCrc(r, f.xingOffset, f.FrameLength(frame), bufferLength)
+}
+
 func (f *File) sanityCheckFrame(frame *FrameHeader, offset int64) os.Error {
 	if f.SampleRate() != frame.SampleRate() {
-		return os.NewError("Inconsistent frame header (sample rate)")
+		return &InvalidDataError{offset, "Inconsistent frame header (sample rate)"}
 	}
 	if f.Layer() != frame.Layer() {
-		return os.NewError("Inconsistent frame header (layer)")
+		return &InvalidDataError{offset, "Inconsistent frame header (layer)"}
 	}
 	if f.Version() != frame.Version() {
-		return os.NewError("Inconsistent frame header (version)")
+		return &InvalidDataError{offset, "Inconsistent frame header (version)"}
 	}
-	if offset+int64(frame.LengthInBytes()) > f.Length() {
-		return os.NewError("Frame would extend beyond end of file")
+	if frame.FreeFormat() != (f.freeFormatSlots > 0) {
+		return &InvalidDataError{offset, "Inconsistent frame header (free format)"}
+	}
+	if f.length >= 0 && offset+int64(f.FrameLength(frame)) > f.Length() {
+		return &InvalidDataError{offset, "Frame would extend beyond end of file"}
 	}
 	return nil
 }
 
+// FrameLength returns the length of a frame of the stream. Unlike
+// FrameHeader.LengthInBytes, it knows the length of free format frames.
+func (f *File) FrameLength(frame *FrameHeader) int {
+	if frame.FreeFormat() {
+		return frame.lengthInSlots(f.freeFormatSlots) * frame.slotSize()
+	}
+	return frame.LengthInBytes()
+}
+
+func (f *File) frameBitrate(frame *FrameHeader) int {
+	if frame.FreeFormat() {
+		perKbps := frame.slotsPerKbps()
+		return int((uint32(f.freeFormatSlots)*frame.SampleRate() + perKbps/2) / perKbps)
+	}
+	return frame.BitrateInKbps()
+}
+
+// measureFreeFormat measures the length of the free format frame at the
+// given offset, whose first bytes are in buf, from the distance to the next
+// similar frame header. If buf does not hold it, the bytes which the
+// longest frame allowed may span are read from r. It returns false if
+// there is no such frame header.
+func (f *File) measureFreeFormat(frame *FrameHeader, r io.ReaderAt, offset int64, buf []byte) bool {
+	if f.findFreeFormatLength(frame, buf) {
+		return true
+	}
+	slots := frame.lengthInSlots(int(frame.slotsPerKbps()*MAXIMUM_FREE_BITRATE/frame.SampleRate())) + 1
+	ahead := make([]byte, slots*frame.slotSize()+4)
+	if len(ahead) <= len(buf) {
+		return false
+	}
+	readn, err := r.ReadAt(ahead, offset)
+	if err != nil && err != os.EOF {
+		return false
+	}
+	return f.findFreeFormatLength(frame, ahead[:readn])
+}
+
+// findFreeFormatLength looks for the header of the frame following the free
+// format frame at the start of buf.
+func (f *File) findFreeFormatLength(frame *FrameHeader, buf []byte) bool {
+	const mask = 0xfffffcc0 // all but padding, private and the last 6 bits
+	padding := frame.lengthInSlots(0)
+	for i := frame.slotSize(); i+4 <= len(buf); i += frame.slotSize() {
+		if buf[i] != 0xff || uint32(unpackInteger(buf[i:i+4]))&mask != uint32(*frame)&mask {
+			continue
+		}
+		slots := i/frame.slotSize() - padding
+		if slots*frame.slotSize() > frame.SideInfoEnd() {
+			f.freeFormatSlots = slots
+			return true
+		}
+	}
+	return false
+}
+
 func (f *File) maxEndOffset() int64 {
+	if f.length < 0 { // streaming, end of stream not reached yet
+		return f.scanLimit
+	}
 	length := f.Length()
 	if f.HasId3v1Tag() {
 		length -= Id3v1_length
@@ -244,18 +487,18 @@ func (f *File) addBitrate(bitrate int) {
 }
 
 func (f *File) Filename() string {
-	return ""
+	return f.filename
 }
 
 func (f *File) LengthInSeconds() int64 {
 	return (f.LengthInMilliseconds() + 500) / 1000
 }
 
-func (f *File) Version() string {
+func (f *File) Version() MpegVersion {
 	return f.version
 }
 
-func (f *File) Layer() string {
+func (f *File) Layer() MpegLayer {
 	return f.layer
 }
 
@@ -271,10 +514,12 @@ func (f *File) Vbr() bool {
 	return len(f.bitrates) > 1
 }
 
-func (f *File) ChannelMode() string {
+func (f *File) ChannelMode() ChannelMode {
 	return f.channelMode
 }
 
+// XingOffset returns the offset of the frame holding the Xing, Info or
+// VBRI header, or -1 if there is none.
 func (f *File) XingOffset() int64 {
 	return f.xingOffset
 }
@@ -299,18 +544,50 @@ func (f *File) EndOffset() int64 {
 	return f.endOffset
 }
 
+// firstFrameOffset returns the offset of the first MPEG frame, the one
+// holding the Xing, Info or VBRI header if there is one.
+func (f *File) firstFrameOffset() int64 {
+	if f.xingOffset >= 0 {
+		return f.xingOffset
+	}
+	return f.startOffset
+}
+
+// HasXingFrame tells if the audio frames are preceded by a frame holding
+// a Xing, Info or VBRI header.
 func (f *File) HasXingFrame() bool {
 	return f.xingOffset >= 0
 }
 
+// XingHeader returns the decoded Xing/Info header, or nil if the file
+// has none or it could not be decoded.
+func (f *File) XingHeader() *XingHeader {
+	return f.xingHeader
+}
+
+// LameTag returns the decoded LAME tag, or nil if the file has none.
+func (f *File) LameTag() *LameTag {
+	return f.lameTag
+}
+
+// VbriHeader returns the decoded VBRI header, or nil if the file has none
+// or it could not be decoded.
+func (f *File) VbriHeader() *VbriHeader {
+	return f.vbriHeader
+}
+
 func (f *File) FrameCount() int {
 	return f.frameCount
 }
 
-func (f *File) Emphasis() string {
+func (f *File) Emphasis() Emphasis {
 	return f.emphasis
 }
 
+func (f *File) ModeExtension() ModeExtension {
+	return f.modeExtension
+}
+
 func (f *File) Original() bool {
 	return f.original
 }
@@ -332,6 +609,88 @@ func (f *File) LengthInMilliseconds() int64 {
 	return int64(d/f.bitrate + 0.5)
 }
 
+// SampleCount returns the number of samples (per channel) that a player
+// should output, i.e. the number of samples in all audio frames minus the
+// encoder delay and padding, if they are known; see GaplessInfo.
+func (f *File) SampleCount() int64 {
+	count, _ := f.gapless()
+	return count
+}
+
+// Duration returns the exact playable length, in nanoseconds, computed
+// from SampleCount.
+func (f *File) Duration() int64 {
+	if f.sampleRate == 0 {
+		return 0
+	}
+	return f.SampleCount() * 1e9 / int64(f.sampleRate)
+}
+
+// GaplessInfo tells where the encoder delay and padding used by
+// SampleCount came from: one of the GAPLESS_INFO_* constants.
+func (f *File) GaplessInfo() string {
+	_, source := f.gapless()
+	return source
+}
+
+func (f *File) gapless() (int64, string) {
+	total := int64(f.frameCount) * int64(f.samplesPerFrame)
+	if f.lameTag != nil {
+		count := total - int64(f.lameTag.EncoderDelay) - int64(f.lameTag.EncoderPadding)
+		if count >= 0 {
+			return count, GAPLESS_INFO_LAME
+		}
+	}
+	if f.id3v2tag != nil {
+		delay, padding, count, ok := parseItunSmpb(f.id3v2tag.CommentByDescription("iTunSMPB"))
+		if ok && count > 0 && count <= total {
+			return count, GAPLESS_INFO_ITUNSMPB
+		}
+		if ok && total-delay-padding >= 0 {
+			return total - delay - padding, GAPLESS_INFO_ITUNSMPB
+		}
+	}
+	return total, GAPLESS_INFO_NONE
+}
+
+// parseItunSmpb decodes the encoder delay, padding and original sample
+// count from the text of an iTunSMPB comment, e.g.:
+// " 00000000 00000210 00000340 00000000000015B0 00000000 ..."
+func parseItunSmpb(text string) (delay, padding, count int64, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) < 4 {
+		return
+	}
+	values := make([]int64, 3)
+	for i := range values {
+		values[i], ok = parseHex(fields[i+1])
+		if !ok {
+			return
+		}
+	}
+	return values[0], values[1], values[2], true
+}
+
+func parseHex(s string) (int64, bool) {
+	if s == "" || len(s) > 16 {
+		return 0, false
+	}
+	v := int64(0)
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			v = v<<4 | int64(c-'0')
+		case c >= 'a' && c <= 'f':
+			v = v<<4 | int64(c-'a'+10)
+		case c >= 'A' && c <= 'F':
+			v = v<<4 | int64(c-'A'+10)
+		default:
+			return 0, false
+		}
+	}
+	return v, true
+}
+
 func (f *File) CustomTag() []byte {
 	return f.customTag
 }
@@ -343,15 +702,3 @@ func (f *File) Id3v1Tag() *Id3v1Tag {
 func (f *File) Id3v2Tag() *id3v2.Tag {
 	return f.id3v2tag
 }
-
-func probeXing(buf []byte, offset int) bool {
-	if len(buf) < offset+3 {
-		return false
-	}
-	probe := string(buf[offset : offset+4])
-	return probe == "Xing" || probe == "Info"
-}
-
-func HasXingFrameTag(buf []byte) bool {
-	return probeXing(buf, 13) || probeXing(buf, 21) || probeXing(buf, 36)
-}
@@ -2,7 +2,9 @@ package mp3agic_test
 
 import (
 	asrt "assert"
+	"io/ioutil"
 	"mp3agic"
+	"mp3agic/id3v2"
 	"os"
 	. "testing"
 )
@@ -52,6 +54,38 @@ func TestErrorForFileThatIsNotAnMp3(t *T) {
 	_, err := loadMp3(t, "notanmp3.mp3", 0)
 	assert(t, err != nil, "err should be non nil")
 	assertEq(t, "No mpegs frames found", err.String(), "error message")
+	_, ok := err.(*mp3agic.InvalidDataError)
+	assert(t, ok, "expected InvalidDataError, got", err)
+}
+
+func TestWarningsForDamagedTag(t *T) {
+	data, err := ioutil.ReadFile(RES_DIR + "v1andv23tags.mp3")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	file, err := mp3agic.Parse(BufReaderAt(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, 0, len(file.Warnings()), "warnings")
+
+	data[52] = 'w' // frame ID of the second ID3v2 frame
+	file, err = mp3agic.Parse(BufReaderAt(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, 1, len(file.Warnings()), "warnings")
+	e, ok := file.Warnings()[0].(*id3v2.InvalidDataError)
+	assert(t, ok, "expected id3v2.InvalidDataError, got", file.Warnings()[0])
+	if ok {
+		assertEq(t, int64(52), e.Offset, "offset")
+		assertEq(t, "wXXX", e.FrameId, "frame id")
+	}
+	assert(t, file.HasId3v2Tag(), "has id3v2 tag")
+	assert(t, file.HasId3v1Tag(), "has id3v1 tag")
 }
 
 func TestIgnoreIncompleteMpegFrame(t *T) {
@@ -68,6 +102,56 @@ func TestIgnoreIncompleteMpegFrame(t *T) {
 	assertEq(t, 5, file.FrameCount(), "frame count")
 }
 
+func TestParseFromMemory(t *T) {
+	data, err := ioutil.ReadFile(RES_DIR + "v1andv23tags.mp3")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	file, err := mp3agic.Parse(BufReaderAt(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, "", file.Filename(), "filename")
+	assertEq(t, int64(0x44b), file.XingOffset(), "xing offset")
+	assertEq(t, int64(0x5ec), file.StartOffset(), "start offset")
+	assertEq(t, int64(0xf7f), file.EndOffset(), "end offset")
+	assert(t, file.HasId3v1Tag(), "has id3v1 tag")
+	assert(t, file.HasId3v2Tag(), "has id3v2 tag")
+}
+
+func TestFilename(t *T) {
+	file, err := loadMp3(t, "notags.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, RES_DIR+"notags.mp3", file.Filename(), "filename")
+}
+
+func TestSampleCount(t *T) {
+	tests := []struct {
+		filename    string
+		samples     int64
+		duration    int64
+		gaplessInfo string
+	}{
+		{"v1andv23tags.mp3", 4410, 100000000, mp3agic.GAPLESS_INFO_LAME},
+		{"vbri.mp3", 6912, 156734693, mp3agic.GAPLESS_INFO_NONE},
+		{"itunsmpb.mp3", 5552, 125895691, mp3agic.GAPLESS_INFO_ITUNSMPB}}
+	for _, test := range tests {
+		file, err := loadMp3(t, test.filename, 0)
+		if err != nil {
+			t.Error(test.filename, err)
+			continue
+		}
+		assertEq(t, test.samples, file.SampleCount(), test.filename, "sample count")
+		assertEq(t, test.duration, file.Duration(), test.filename, "duration")
+		assertEq(t, test.gaplessInfo, file.GaplessInfo(), test.filename, "gapless info")
+	}
+}
+
 func loadAndCheckTestMp3WithNoTags(t *T, length int64, bufferLength int) {
 	file := loadAndCheckTestMp3(t, "notags.mp3", length, bufferLength)
 	assertEq(t, int64(0x000), file.XingOffset(), "xing offset")
@@ -99,16 +183,7 @@ func loadAndCheckTestMp3WithCustomTag(t *T, filename string, length int64, buffe
 }
 
 func loadMp3(t *T, filename string, bufferLength int) (*mp3agic.File, os.Error) {
-	// TODO: buffer the file
-	rawfile, err := os.Open(RES_DIR+filename, os.O_RDONLY, 0)
-	if err != nil {
-		t.Fatal(err)
-		return nil, err
-	}
-	defer rawfile.Close()
-
-	file, err := mp3agic.ParseFile(rawfile, bufferLength)
-	return file, err
+	return mp3agic.ParseFile(RES_DIR+filename, &mp3agic.ParseOptions{BufferLength: bufferLength})
 }
 
 func loadAndCheckTestMp3(t *T, filename string, length int64, bufferLength int) *mp3agic.File {
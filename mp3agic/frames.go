@@ -0,0 +1,66 @@
+package mp3agic
+
+// MpegFrame is the index record of an audio frame, see ParseOptions.IndexFrames.
+type MpegFrame struct {
+	Offset      int64 // of the frame header in the stream
+	Header      FrameHeader
+	Length      int   // in bytes, including the header
+	FirstSample int64 // index of the first sample of the frame in the stream
+
+	// MainDataBegin is the Layer III bit reservoir back pointer: the
+	// number of bytes, before this frame's header, at which its main
+	// data starts. It is -1 for Layer I and II frames.
+	MainDataBegin int
+}
+
+// HasCrc tells if a CRC-16 follows the frame header.
+func (fr *MpegFrame) HasCrc() bool {
+	return fr.Header.Protection()
+}
+
+// Timestamp returns the time of the first sample of the frame, in
+// nanoseconds.
+func (fr *MpegFrame) Timestamp() int64 {
+	return fr.FirstSample * 1e9 / int64(fr.Header.SampleRate())
+}
+
+// newMpegFrame indexes the frame whose header is at the start of buf,
+// which must hold the side information too.
+func newMpegFrame(header *FrameHeader, length int, buf []byte, offset int64, firstSample int64) MpegFrame {
+	fr := MpegFrame{
+		Offset:        offset,
+		Header:        *header,
+		Length:        length,
+		FirstSample:   firstSample,
+		MainDataBegin: -1}
+	if header.Layer() == MPEG_LAYER_3 {
+		side := buf[header.SideInfoStart():]
+		if header.Version() == MPEG_VERSION_1_0 {
+			fr.MainDataBegin = int(side[0])<<1 | int(side[1]>>7)
+		} else {
+			fr.MainDataBegin = int(side[0])
+		}
+	}
+	return fr
+}
+
+// indexFrame records the frame at the start of buf in the frame index, if
+// one is kept.
+func (f *File) indexFrame(header *FrameHeader, buf []byte, offset int64) {
+	if !f.indexFrames {
+		return
+	}
+	firstSample := int64(0)
+	if n := len(f.frames); n > 0 {
+		last := &f.frames[n-1]
+		firstSample = last.FirstSample + int64(last.Header.SamplesPerFrame())
+	}
+	f.frames = append(f.frames, newMpegFrame(header, f.FrameLength(header), buf, offset, firstSample))
+}
+
+// Frames returns the index of the audio frames, in stream order. It is
+// only kept if ParseOptions.IndexFrames was set; otherwise nil is
+// returned.
+func (f *File) Frames() []MpegFrame {
+	return f.frames
+}
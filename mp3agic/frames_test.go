@@ -0,0 +1,53 @@
+package mp3agic_test
+
+import (
+	"mp3agic"
+	. "testing"
+)
+
+func TestFrameIndex(t *T) {
+	file, err := mp3agic.ParseFile(RES_DIR+"notags.mp3", &mp3agic.ParseOptions{IndexFrames: true})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	offsets := []int64{0x1a1, 0x47c, 0x5e9, 0x722, 0x85b, 0xacd}
+	lengths := []int{731, 365, 313, 313, 626, 104}
+	mainDataBegins := []int{0, 37, 56, 59, 43, 44}
+	frames := file.Frames()
+	assertEq(t, file.FrameCount(), len(frames), "frame count")
+	for i, frame := range frames {
+		assertEq(t, offsets[i], frame.Offset, "offset", i)
+		assertEq(t, lengths[i], frame.Length, "length", i)
+		assertEq(t, int64(i*1152), frame.FirstSample, "first sample", i)
+		assertEq(t, int64(i)*1152*1e9/44100, frame.Timestamp(), "timestamp", i)
+		assertEq(t, mainDataBegins[i], frame.MainDataBegin, "main data begin", i)
+		assert(t, !frame.HasCrc(), "has crc", i)
+	}
+}
+
+func TestFrameIndexIsOptional(t *T) {
+	file, err := loadMp3(t, "notags.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assert(t, file.Frames() == nil, "frames should be nil")
+}
+
+func TestStreamFrameIndexMatchesParse(t *T) {
+	for _, bufferLength := range []int{41, 256, 5000} {
+		opts := &mp3agic.ParseOptions{BufferLength: bufferLength, IndexFrames: true}
+		expected, err := mp3agic.ParseFile(RES_DIR+"v1andv23tags.mp3", opts)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		file, err := streamMp3WithOptions(t, "v1andv23tags.mp3", opts)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		assertEq(t, expected.Frames(), file.Frames(), "frames", bufferLength)
+	}
+}
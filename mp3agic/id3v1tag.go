@@ -1,36 +1,50 @@
 package mp3agic
 
 import (
+	"bytes"
 	"io"
+	"mp3agic/id3v2"
 	"os"
 	"strconv"
+	"utf16"
 )
 
 type Id3v1Tag [128]byte
 
 const (
-	Id3v1_length = 128
-	id3v1_magic  = "TAG"
+	Id3v1_length          = 128
+	Id3v1_extended_length = 227 // the "TAG+" block which may precede the tag
+	id3v1_magic           = "TAG"
+	id3v1_extended_magic  = "TAG+"
 )
 
-func ExtractId3v1Tag(mp3stream io.ReadSeeker) (*Id3v1Tag, os.Error) {
+// NewId3v1Tag returns an empty tag, without genre.
+func NewId3v1Tag() *Id3v1Tag {
 	var tag Id3v1Tag
+	copy(tag[:], id3v1_magic)
+	tag[127] = 0xff
+	return &tag
+}
 
-	_, err := mp3stream.Seek(int64(-len(tag)), 2) // at end of file
-	if err != nil {
-		return nil, err
-	}
+// ExtractId3v1Tag reads the ID3v1 tag from the last 128 bytes of a
+// stream of the given size. An id3v2.NoSuchTagError is returned if there
+// is none.
+func ExtractId3v1Tag(mp3stream io.ReaderAt, size int64) (*Id3v1Tag, os.Error) {
+	var tag Id3v1Tag
 
-	readn, err := mp3stream.Read(tag[:])
-	if err != nil {
-		return nil, err
+	if size < int64(len(tag)) {
+		return nil, &id3v2.NoSuchTagError{Message: "stream too short for ID3v1 tag"}
 	}
+	readn, err := mp3stream.ReadAt(tag[:], size-int64(len(tag))) // at end of file
 	if readn != len(tag) {
-		return nil, os.NewError("stream too short for ID3v1 tag")
+		if err != nil {
+			return nil, err
+		}
+		return nil, &id3v2.NoSuchTagError{Message: "stream too short for ID3v1 tag"}
 	}
 
 	if !tag.Valid() {
-		return nil, os.NewError("stream does not contain ID3v1 magic code")
+		return nil, &id3v2.NoSuchTagError{Message: "stream does not contain ID3v1 magic code"}
 	}
 	return &tag, nil
 }
@@ -75,11 +89,11 @@ func (tag *Id3v1Tag) Genre() int {
 }
 
 func (tag *Id3v1Tag) GenreDescription() string {
-	genre := tag.Genre()
-	if genre < 0 || genre >= len(id3v1_genres) {
+	name := id3v2.GenreName(tag.Genre())
+	if name == "" {
 		return "Unknown"
 	}
-	return id3v1_genres[genre]
+	return name
 }
 
 func (tag *Id3v1Tag) Comment() string {
@@ -96,6 +110,65 @@ func (tag *Id3v1Tag) Version() string {
 	return "0"
 }
 
+func (tag *Id3v1Tag) SetTitle(title string) {
+	tag.setField(3, 30, title)
+}
+
+func (tag *Id3v1Tag) SetArtist(artist string) {
+	tag.setField(33, 30, artist)
+}
+
+func (tag *Id3v1Tag) SetAlbum(album string) {
+	tag.setField(63, 30, album)
+}
+
+func (tag *Id3v1Tag) SetYear(year string) {
+	tag.setField(93, 4, year)
+}
+
+// SetComment sets the comment, truncated to 28 characters if the tag has a
+// track number.
+func (tag *Id3v1Tag) SetComment(comment string) {
+	if tag.hasTrack() && tag[126] != 0 {
+		tag.setField(97, 28, comment)
+	} else {
+		tag.setField(97, 30, comment)
+	}
+}
+
+// SetTrack sets the track number, making the tag an ID3v1.1 tag, whose
+// comment is truncated to 28 characters. 0 removes the track number.
+func (tag *Id3v1Tag) SetTrack(track int) os.Error {
+	if track < 0 || track > 255 {
+		return os.NewError("ID3v1 track number out of range: " + strconv.Itoa(track))
+	}
+	if track != 0 || tag.hasTrack() {
+		tag[125], tag[126] = 0, byte(track)
+	}
+	return nil
+}
+
+// SetGenre sets the genre by number, -1 for none.
+func (tag *Id3v1Tag) SetGenre(genre int) os.Error {
+	if genre < -1 || genre > 255 {
+		return os.NewError("ID3v1 genre out of range: " + strconv.Itoa(genre))
+	}
+	tag[127] = byte(genre) // -1 is 0xff
+	return nil
+}
+
+// SetGenreByName sets the genre by its name, such as "Hip-Hop", ignoring
+// case.
+func (tag *Id3v1Tag) SetGenreByName(name string) os.Error {
+	genre := id3v2.GenreNumber(name)
+	if genre < 0 {
+		return os.NewError("unknown ID3v1 genre: " + name)
+	}
+	return tag.SetGenre(genre)
+}
+
+// substring decodes a field in ISO-8859-1, without the trailing spaces and
+// null bytes.
 func (tag *Id3v1Tag) substring(offset, length int) string {
 	pos := offset + length - 1
 	for ; pos >= offset; pos-- {
@@ -106,153 +179,158 @@ func (tag *Id3v1Tag) substring(offset, length int) string {
 	if pos < offset {
 		return ""
 	}
-	return string(tag[offset : pos+1])
+	field := make([]uint16, pos+1-offset)
+	for i := range field {
+		field[i] = uint16(tag[offset+i])
+	}
+	return string(utf16.Decode(field))
+}
+
+// setField encodes value in ISO-8859-1, truncated and padded with null
+// bytes. Characters which ISO-8859-1 lacks are replaced with '?', see
+// Transliterate.
+func (tag *Id3v1Tag) setField(offset, length int, value string) {
+	field := tag[offset : offset+length]
+	i := 0
+	for _, c := range value {
+		if i == length {
+			break
+		}
+		if c > 0xff {
+			c = '?'
+		}
+		field[i] = byte(c)
+		i++
+	}
+	for ; i < length; i++ {
+		field[i] = 0
+	}
 }
 
 func (tag *Id3v1Tag) hasTrack() bool {
 	return tag[125] == 0
 }
 
-var id3v1_genres = [...]string{
-	"Blues",
-	"Classic Rock",
-	"Country",
-	"Dance",
-	"Disco",
-	"Funk",
-	"Grunge",
-	"Hip-Hop",
-	"Jazz",
-	"Metal",
-	"New Age",
-	"Oldies",
-	"Other",
-	"Pop",
-	"R&B",
-	"Rap",
-	"Reggae",
-	"Rock",
-	"Techno",
-	"Industrial",
-	"Alternative",
-	"Ska",
-	"Death Metal",
-	"Pranks",
-	"Soundtrack",
-	"Euro-Techno",
-	"Ambient",
-	"Trip-Hop",
-	"Vocal",
-	"Jazz+Funk",
-	"Fusion",
-	"Trance",
-	"Classical",
-	"Instrumental",
-	"Acid",
-	"House",
-	"Game",
-	"Sound Clip",
-	"Gospel",
-	"Noise",
-	"Alt Rock",
-	"Bass",
-	"Soul",
-	"Punk",
-	"Space",
-	"Meditative",
-	"Instrumental Pop",
-	"Instrumental Rock",
-	"Ethnic",
-	"Gothic",
-	"Darkwave",
-	"Techno-Industrial",
-	"Electronic",
-	"Pop-Folk",
-	"Eurodance",
-	"Dream",
-	"Southern Rock",
-	"Comedy",
-	"Cult",
-	"Gangsta",
-	"Top 40",
-	"Christian Rap",
-	"Pop/Funk",
-	"Jungle",
-	"Native American",
-	"Cabaret",
-	"New Wave",
-	"Psychedelic",
-	"Rave",
-	"Showtunes",
-	"Trailer",
-	"Lo-Fi",
-	"Tribal",
-	"Acid Punk",
-	"Acid Jazz",
-	"Polka",
-	"Retro",
-	"Musical",
-	"Rock & Roll",
-	"Hard Rock",
-	"Folk",
-	"Folk/Rock",
-	"National Folk",
-	"Swing",
-	"Fast Fusion",
-	"Bebob",
-	"Latin",
-	"Revival",
-	"Celtic",
-	"Bluegrass",
-	"Avantgarde",
-	"Gothic Rock",
-	"Progressive Rock",
-	"Psychedelic Rock",
-	"Symphonic Rock",
-	"Slow Rock",
-	"Big Band",
-	"Chorus",
-	"Easy Listening",
-	"Acoustic",
-	"Humour",
-	"Speech",
-	"Chanson",
-	"Opera",
-	"Chamber Music",
-	"Sonata",
-	"Symphony",
-	"Booty Bass",
-	"Primus",
-	"Porn Groove",
-	"Satire/Parody",
-	"Slow Jam",
-	"Club",
-	"Tango",
-	"Samba",
-	"Folklore",
-	"Ballad",
-	"Power Ballad",
-	"Rhythmic Soul",
-	"Freestyle",
-	"Duet",
-	"Punk Rock",
-	"Drum Solo",
-	"Acapella",
-	"Euro-House",
-	"Dance Hall",
-	"Goa",
-	"Drum & Bass",
-	"Club-House",
-	"Hardcore",
-	"Terror",
-	"Indie",
-	"BritPop",
-	"Negerpunk",
-	"Polsk Punk",
-	"Beat",
-	"Christian Gangsta",
-	"Heavy Metal",
-	"Thrash Metal",
-	"Anime",
-	"JPop",
-	"Synthpop"}
+// Transliterate replaces the Latin letters and the punctuation which
+// ISO-8859-1 lacks with close ASCII characters, so that they survive in an
+// ID3v1 tag. Other characters are left alone.
+func Transliterate(s string) string {
+	var buf bytes.Buffer
+	for _, c := range s {
+		switch {
+		case c >= 0x100 && c < 0x180 && latinExtendedA[c-0x100] != '?':
+			buf.WriteByte(latinExtendedA[c-0x100])
+		case transliterations[int(c)] != "":
+			buf.WriteString(transliterations[int(c)])
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
+
+// latinExtendedA gives the base letters of U+0100 to U+017F, '?' for those
+// found in transliterations.
+const latinExtendedA = "AaAaAaCcCcCcCcDdDdEeEeEeEeEeGgGgGgGgHhHhIiIiIiIiIi??JjKkkLlLlLlLlLl" +
+	"NnNnNnnNnOoOoOo??RrRrRrSsSsSsSsTtTtTtUuUuUuUuUuUuWwYyYZzZzZzs"
+
+var transliterations = map[int]string{
+	0x0132: "IJ",
+	0x0133: "ij",
+	0x0152: "OE",
+	0x0153: "oe",
+	0x0218: "S", // comma below
+	0x0219: "s",
+	0x021a: "T",
+	0x021b: "t",
+	0x2013: "-", // en dash
+	0x2014: "-", // em dash
+	0x2018: "'",
+	0x2019: "'",
+	0x201a: "'",
+	0x201c: "\"",
+	0x201d: "\"",
+	0x201e: "\"",
+	0x2022: "*",
+	0x2026: "...",
+	0x20ac: "EUR",
+	0x2122: "TM",
+}
+
+// AppendId3v1Tag appends tag to the named file, which must not already
+// have an ID3v1 tag.
+func AppendId3v1Tag(filename string, tag *Id3v1Tag) os.Error {
+	return writeId3v1TagFile(filename, tag, false)
+}
+
+// ReplaceId3v1Tag replaces the ID3v1 tag of the named file, and the
+// extended "TAG+" block which may precede it, with tag. It is appended if
+// the file has none.
+func ReplaceId3v1Tag(filename string, tag *Id3v1Tag) os.Error {
+	return writeId3v1TagFile(filename, tag, true)
+}
+
+// StripId3v1Tag removes the ID3v1 tag of the named file, and the extended
+// "TAG+" block which may precede it.
+func StripId3v1Tag(filename string) os.Error {
+	return writeId3v1TagFile(filename, nil, true)
+}
+
+func writeId3v1TagFile(filename string, tag *Id3v1Tag, replace bool) os.Error {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	length, err := id3v1Length(f, stat.Size)
+	if err == nil && length > 0 && !replace {
+		err = os.NewError("file already has an ID3v1 tag")
+	}
+	if err == nil {
+		err = writeId3v1Tag(f, stat.Size, length, tag)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeId3v1Tag writes tag at the end of f, a file of the given size, in
+// place of its last length bytes, which hold its ID3v1 tag, see
+// id3v1Length. A nil tag strips it.
+func writeId3v1Tag(f *os.File, size, length int64, tag *Id3v1Tag) os.Error {
+	var err os.Error
+	end := size - length
+	if tag != nil {
+		_, err = f.WriteAt(tag[:], end)
+		end += Id3v1_length
+	}
+	if err == nil && end < size {
+		err = f.Truncate(end)
+	}
+	return err
+}
+
+// id3v1Length returns the length of the ID3v1 tag at the end of a stream
+// of the given size, with the extended "TAG+" block if there is one, or 0
+// if there is no tag.
+func id3v1Length(r io.ReaderAt, size int64) (int64, os.Error) {
+	_, err := ExtractId3v1Tag(r, size)
+	if _, ok := err.(*id3v2.NoSuchTagError); ok {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	offset := size - Id3v1_length - Id3v1_extended_length
+	if offset >= 0 {
+		magic := make([]byte, len(id3v1_extended_magic))
+		readn, _ := r.ReadAt(magic, offset)
+		if readn == len(magic) && string(magic) == id3v1_extended_magic {
+			return Id3v1_length + Id3v1_extended_length, nil
+		}
+	}
+	return Id3v1_length, nil
+}
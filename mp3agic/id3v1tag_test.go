@@ -33,6 +33,11 @@ func TestValid(t *testing.T) {
 }
 
 func TestReadTagFieldsFromMp3(t *testing.T) {
+	stat, err := os.Stat(RES_DIR + "v1andv23tags.mp3")
+	if err != nil {
+		t.Error(err)
+		return
+	}
 	f, err := os.Open(RES_DIR+"v1andv23tags.mp3", os.O_RDONLY, 0)
 	if err != nil {
 		t.Error(err)
@@ -40,7 +45,7 @@ func TestReadTagFieldsFromMp3(t *testing.T) {
 	}
 	defer f.Close()
 
-	tag, err := mp3agic.ExtractId3v1Tag(f)
+	tag, err := mp3agic.ExtractId3v1Tag(f, stat.Size)
 	if err != nil {
 		t.Error(err)
 		return
@@ -79,7 +84,7 @@ const (
 func TestExtractMaximumLengthFieldsFromValid10Tag(t *testing.T) {
 	buf, reader := bufWrap(VALID_TAG)
 	buf[len(buf)-1] = 0x8D
-	tag, err := mp3agic.ExtractId3v1Tag(reader)
+	tag, err := mp3agic.ExtractId3v1Tag(reader, int64(len(buf)))
 	if err != nil {
 		t.Error(err)
 		return
@@ -99,7 +104,7 @@ func TestExtractMaximumLengthFieldsFromValid11Tag(t *testing.T) {
 	buf[len(buf)-3] = 0x00
 	buf[len(buf)-2] = 0x01
 	buf[len(buf)-1] = 0x0d
-	tag, err := mp3agic.ExtractId3v1Tag(r)
+	tag, err := mp3agic.ExtractId3v1Tag(r, int64(len(buf)))
 	if err != nil {
 		t.Error(err)
 		return
@@ -115,7 +120,7 @@ func TestExtractTrimmedFieldsFromValid11TagWithWhitespace(t *testing.T) {
 	buf[len(buf)-3] = 0x00
 	buf[len(buf)-2] = 0x01
 	buf[len(buf)-1] = 0x0d
-	tag, err := mp3agic.ExtractId3v1Tag(r)
+	tag, err := mp3agic.ExtractId3v1Tag(r, int64(len(buf)))
 	if err != nil {
 		t.Error(err)
 		return
@@ -135,7 +140,7 @@ func TestExtractTrimmedFieldsFromValid11TagWithNullspace(t *testing.T) {
 	buf[len(buf)-3] = 0x00
 	buf[len(buf)-2] = 0x01
 	buf[len(buf)-1] = 0x0d
-	tag, err := mp3agic.ExtractId3v1Tag(r)
+	tag, err := mp3agic.ExtractId3v1Tag(r, int64(len(buf)))
 	if err != nil {
 		t.Error(err)
 		return
@@ -149,3 +154,89 @@ func TestExtractTrimmedFieldsFromValid11TagWithNullspace(t *testing.T) {
 	assert(t, tag.Genre() == 0x0D, "genre", tag.Genre())
 	assert(t, tag.GenreDescription() == "Pop", "genre description", tag.GenreDescription())
 }
+
+func TestSetTagFields(t *testing.T) {
+	tag := mp3agic.NewId3v1Tag()
+	assert(t, tag.Valid(), "expected new tag to be valid")
+	assert(t, tag.Genre() == -1, "genre", tag.Genre())
+	tag.SetTitle("TITLE1234567890123456789012345TOO LONG")
+	tag.SetArtist("Café")
+	tag.SetAlbum("Łódź")
+	tag.SetYear("2001")
+	tag.SetComment("COMMENT12345678901234567890123")
+	assert(t, tag.Title() == "TITLE1234567890123456789012345", "title", tag.Title())
+	assert(t, tag.Artist() == "Café", "artist", tag.Artist())
+	assert(t, tag.Album() == "?ód?", "album", tag.Album())
+	assert(t, tag.Year() == "2001", "year", tag.Year())
+	assert(t, tag.Comment() == "COMMENT12345678901234567890123", "comment", tag.Comment())
+	assert(t, tag.Version() == "0", "version", tag.Version())
+
+	assert(t, tag.SetTrack(12) == nil, "track 12 expected to be accepted")
+	assert(t, tag.SetTrack(256) != nil, "track 256 expected to be rejected")
+	assert(t, tag.Track() == "12", "track", tag.Track())
+	assert(t, tag.Version() == "1", "version", tag.Version())
+	assert(t, tag.Comment() == "COMMENT123456789012345678901", "comment truncated by track", tag.Comment())
+	tag.SetComment("Short")
+	assert(t, tag.Comment() == "Short" && tag.Track() == "12", "comment", tag.Comment(), "track", tag.Track())
+
+	assert(t, tag.SetGenreByName("hip-hop") == nil, "genre name expected to be found")
+	assert(t, tag.GenreDescription() == "Hip-Hop", "genre description", tag.GenreDescription())
+	assert(t, tag.SetGenreByName("No Such Genre") != nil, "unknown genre name expected to be rejected")
+	assert(t, tag.SetGenre(-1) == nil && tag.Genre() == -1, "genre", tag.Genre())
+
+	tag.SetAlbum(mp3agic.Transliterate("Łódź “Œuvre” – Ω"))
+	assert(t, tag.Album() == "Lódz \"OEuvre\" - ?", "transliterated album", tag.Album())
+}
+
+func TestWriteId3v1TagToFile(t *testing.T) {
+	filename := copyTestFile(t, "notags.mp3")
+	defer os.Remove(filename)
+	stat, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := stat.Size
+	readTag := func() (*mp3agic.Id3v1Tag, int64) {
+		stat, err := os.Stat(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(filename, os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		tag, _ := mp3agic.ExtractId3v1Tag(f, stat.Size)
+		return tag, stat.Size
+	}
+
+	tag := mp3agic.NewId3v1Tag()
+	tag.SetTitle("First")
+	assert(t, mp3agic.AppendId3v1Tag(filename, tag) == nil, "append expected to succeed")
+	assert(t, mp3agic.AppendId3v1Tag(filename, tag) != nil, "second append expected to fail")
+	written, length := readTag()
+	assert(t, written != nil && written.Title() == "First", "appended tag", written)
+	assert(t, length == size+mp3agic.Id3v1_length, "length", length)
+
+	// an extended tag followed by a tag
+	f, err := os.Open(filename, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extended := make([]byte, mp3agic.Id3v1_extended_length)
+	copy(extended, "TAG+")
+	f.WriteAt(extended, size)
+	f.WriteAt(tag[:], size+mp3agic.Id3v1_extended_length)
+	f.Close()
+
+	tag.SetTitle("Second")
+	assert(t, mp3agic.ReplaceId3v1Tag(filename, tag) == nil, "replace expected to succeed")
+	written, length = readTag()
+	assert(t, written != nil && written.Title() == "Second", "replaced tag", written)
+	assert(t, length == size+mp3agic.Id3v1_length, "length without extended tag", length)
+
+	assert(t, mp3agic.StripId3v1Tag(filename) == nil, "strip expected to succeed")
+	written, length = readTag()
+	assert(t, written == nil, "stripped tag", written)
+	assert(t, length == size, "length", length)
+}
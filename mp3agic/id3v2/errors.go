@@ -0,0 +1,55 @@
+package id3v2
+
+import (
+	"fmt"
+)
+
+// NoSuchTagError reports that a stream holds no ID3v2 tag, or no ID3v1
+// tag when returned by the mp3agic package.
+type NoSuchTagError struct {
+	Message string
+}
+
+func (e *NoSuchTagError) String() string {
+	return e.Message
+}
+
+// UnsupportedTagError reports an ID3v2 tag of a version, or using
+// features, which this package cannot decode.
+type UnsupportedTagError struct {
+	Version string // major and minor version, e.g. "5.0"
+	Message string
+}
+
+func (e *UnsupportedTagError) String() string {
+	return e.Message
+}
+
+// InvalidDataError reports a damaged ID3v2 tag.
+type InvalidDataError struct {
+	Offset  int64  // in the stream, -1 if not known
+	FrameId string // the frame concerned, if any
+	Message string
+}
+
+func (e *InvalidDataError) String() string {
+	s := e.Message
+	if e.FrameId != "" {
+		s = fmt.Sprintf("%s (frame %q)", s, e.FrameId)
+	}
+	if e.Offset >= 0 {
+		s = fmt.Sprintf("%s at offset 0x%x", s, e.Offset)
+	}
+	return s
+}
+
+// EncryptedFrameError reports a frame which cannot be decoded because it
+// is encrypted.
+type EncryptedFrameError struct {
+	FrameId string
+	Method  int // the method symbol, see Frame.EncryptionMethod
+}
+
+func (e *EncryptedFrameError) String() string {
+	return fmt.Sprintf("frame %q is encrypted with method 0x%02x", e.FrameId, e.Method)
+}
@@ -1,34 +1,93 @@
 package id3v2
 
 import (
+	"bytes"
+	"compress/zlib"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"utf16"
+)
+
+const (
+	FRAME_HEADER_LENGTH          = 10
+	OBSOLETE_FRAME_HEADER_LENGTH = 6 // ID3v2.2
+)
+
+// text encodings
+const (
+	ENCODING_ISO_8859_1 = 0
+	ENCODING_UTF_16     = 1 // with byte order mark
+	ENCODING_UTF_16BE   = 2 // ID3v2.4 only
+	ENCODING_UTF_8      = 3 // ID3v2.4 only
 )
 
 type Frame struct {
-	Header [10]byte
-	Data   []byte
+	Header  []byte // FRAME_HEADER_LENGTH or OBSOLETE_FRAME_HEADER_LENGTH bytes
+	Data    []byte // with unsynchronisation reversed
+	Version int    // major version of the tag holding the frame
 }
 
-// TODO: obsolete frame format (ID3v2ObseleteFrame.java)
-func extractFrame(mp3stream io.ReadSeeker) (*Frame, os.Error) {
-	frame := Frame{}
+// frameFlagBits gives the bits of the frame header flags, which moved
+// between ID3v2.3 and ID3v2.4.
+type frameFlagBits struct {
+	tagAlterPreservation  uint16
+	fileAlterPreservation uint16
+	readOnly              uint16
+	grouping              uint16
+	compression           uint16
+	encryption            uint16
+	unsynchronisation     uint16
+	dataLengthIndicator   uint16
+}
+
+var (
+	frameFlags23 = &frameFlagBits{0x8000, 0x4000, 0x2000, 0x0020, 0x0080, 0x0040, 0, 0}
+	frameFlags24 = &frameFlagBits{0x4000, 0x2000, 0x1000, 0x0040, 0x0008, 0x0004, 0x0002, 0x0001}
+)
 
-	err := readStream(mp3stream, frame.Header[:])
+// errPadding is returned by extractFrame when it finds the padding which
+// follows the last frame.
+var errPadding = os.NewError("ID3v2 padding")
+
+// extractFrame reads the frame found at the given offset in the stream,
+// from a tag of the given major version with at most remaining bytes left.
+// os.EOF is returned if the stream ends before the frame.
+func extractFrame(mp3stream io.Reader, offset int64, version int, remaining int64) (*Frame, os.Error) {
+	headerLength := FRAME_HEADER_LENGTH
+	if version == 2 {
+		headerLength = OBSOLETE_FRAME_HEADER_LENGTH
+	}
+	frame := Frame{Header: make([]byte, headerLength), Version: version}
+
+	readn, err := io.ReadFull(mp3stream, frame.Header)
+	if readn == 0 && err != nil {
+		return nil, os.EOF
+	}
+	if frame.Header[0] == 0 {
+		return nil, errPadding
+	}
 	if err != nil {
-		return nil, err
+		return nil, &InvalidDataError{offset, "", "Frame header truncated"}
 	}
 
 	err = frame.ValidateHeader()
 	if err != nil {
+		if e, ok := err.(*InvalidDataError); ok {
+			e.Offset = offset
+		}
 		return nil, err
 	}
 
-	frame.Data = make([]byte, frame.DataLength())
-	err = readStream(mp3stream, frame.Data)
+	length := frame.DataLength()
+	if length < 0 || int64(headerLength)+int64(length) > remaining {
+		return nil, &InvalidDataError{offset, frame.Id(), "Frame extends beyond end of tag"}
+	}
+	frame.Data = make([]byte, length)
+	_, err = io.ReadFull(mp3stream, frame.Data)
 	if err != nil {
-		return nil, err
+		return nil, &InvalidDataError{offset, frame.Id(), "Frame extends beyond end of tag"}
 	}
 
 	return &frame, nil
@@ -39,20 +98,200 @@ func (frame *Frame) ValidateHeader() os.Error {
 	for i := 0; i < len(id); i++ {
 		c := int(id[i])
 		if !((c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
-			return os.NewError("invalid ID3v2 frame tag: " + id)
+			return &InvalidDataError{-1, id, "invalid ID3v2 frame tag"}
 		}
 	}
 	return nil
 }
 
 func (frame *Frame) Id() string {
-	return string(frame.Header[0:4])
+	return string(frame.Header[0:frame.idLength()])
 }
 
 func (frame *Frame) DataLength() int {
+	if frame.obsolete() {
+		return int(unpackInteger([]byte{0, frame.Header[3], frame.Header[4], frame.Header[5]}))
+	}
+	if frame.Version == 4 {
+		return int(unpackSynchsafeInteger(frame.Header[4:8]))
+	}
 	return int(unpackInteger(frame.Header[4:8]))
 }
 
+func (frame *Frame) flagBits() *frameFlagBits {
+	if frame.Version == 4 {
+		return frameFlags24
+	}
+	return frameFlags23
+}
+
+func (frame *Frame) flags() uint16 {
+	if frame.obsolete() {
+		return 0 // ID3v2.2 frames have no flags
+	}
+	return uint16(frame.Header[8])<<8 | uint16(frame.Header[9])
+}
+
+func (frame *Frame) hasFlag(bit uint16) bool {
+	return frame.flags()&bit != 0
+}
+
+// TagAlterPreservation tells if the frame should be discarded when the
+// tag is altered by a program which does not know it.
+func (frame *Frame) TagAlterPreservation() bool {
+	return frame.hasFlag(frame.flagBits().tagAlterPreservation)
+}
+
+// FileAlterPreservation tells if the frame should be discarded when the
+// audio data is altered.
+func (frame *Frame) FileAlterPreservation() bool {
+	return frame.hasFlag(frame.flagBits().fileAlterPreservation)
+}
+
+func (frame *Frame) ReadOnly() bool {
+	return frame.hasFlag(frame.flagBits().readOnly)
+}
+
+// Grouping tells if the data starts with a group identifier byte.
+func (frame *Frame) Grouping() bool {
+	return frame.hasFlag(frame.flagBits().grouping)
+}
+
+func (frame *Frame) Compressed() bool {
+	return frame.hasFlag(frame.flagBits().compression)
+}
+
+func (frame *Frame) Encrypted() bool {
+	return frame.hasFlag(frame.flagBits().encryption)
+}
+
+// Unsynchronised tells if unsynchronisation was applied to the frame
+// alone, which only ID3v2.4 allows.
+func (frame *Frame) Unsynchronised() bool {
+	return frame.hasFlag(frame.flagBits().unsynchronisation)
+}
+
+// HasDataLengthIndicator tells if the data holds the length of the frame
+// content once decoded. Compressed frames always have it in ID3v2.3.
+func (frame *Frame) HasDataLengthIndicator() bool {
+	if frame.Version == 3 {
+		return frame.Compressed()
+	}
+	return frame.hasFlag(frame.flagBits().dataLengthIndicator)
+}
+
+// DataLengthIndicator returns the length of the frame content once
+// decoded, or -1 if the frame does not give it.
+func (frame *Frame) DataLengthIndicator() int {
+	offset := frame.extraFields().dataLength
+	if offset < 0 {
+		return -1
+	}
+	if frame.Version == 4 {
+		return int(unpackSynchsafeInteger(frame.Data[offset:]))
+	}
+	return int(unpackInteger(frame.Data[offset:]))
+}
+
+// frameExtraFields holds the offsets in the frame data of the fields
+// announced by the frame flags, -1 for absent ones, and of the content
+// which follows them.
+type frameExtraFields struct {
+	group, method, dataLength, content int
+}
+
+// extraFields locates the fields announced by the frame flags. ID3v2.3
+// puts the decompressed size first, ID3v2.4 the data length indicator
+// last.
+func (frame *Frame) extraFields() frameExtraFields {
+	fields := frameExtraFields{-1, -1, -1, 0}
+	next := func(length int) int {
+		if fields.content+length > len(frame.Data) {
+			return -1
+		}
+		offset := fields.content
+		fields.content += length
+		return offset
+	}
+	if frame.Version == 3 && frame.HasDataLengthIndicator() {
+		fields.dataLength = next(4)
+	}
+	if frame.Version == 4 && frame.Grouping() {
+		fields.group = next(1)
+	}
+	if frame.Encrypted() {
+		fields.method = next(1)
+	}
+	if frame.Version == 3 && frame.Grouping() {
+		fields.group = next(1)
+	}
+	if frame.Version == 4 && frame.HasDataLengthIndicator() {
+		fields.dataLength = next(4)
+	}
+	return fields
+}
+
+// GroupId returns the group identifier of the frame, or -1 if it does not
+// belong to a group.
+func (frame *Frame) GroupId() int {
+	offset := frame.extraFields().group
+	if offset < 0 {
+		return -1
+	}
+	return int(frame.Data[offset])
+}
+
+// EncryptionMethod returns the method symbol, which an ENCR frame of the
+// tag registers, of an encrypted frame, or -1 if the frame is not
+// encrypted.
+func (frame *Frame) EncryptionMethod() int {
+	offset := frame.extraFields().method
+	if offset < 0 {
+		return -1
+	}
+	return int(frame.Data[offset])
+}
+
+// Content returns the frame data without the fields announced by the
+// frame flags, decompressed. The content of an encrypted frame cannot be
+// decoded: it is returned as is, along with an *EncryptedFrameError.
+func (frame *Frame) Content() ([]byte, os.Error) {
+	content := frame.Data[frame.extraFields().content:]
+	if frame.Encrypted() {
+		return content, &EncryptedFrameError{frame.Id(), frame.EncryptionMethod()}
+	}
+	if !frame.Compressed() {
+		return content, nil
+	}
+
+	r, err := zlib.NewReader(bytes.NewBuffer(content))
+	if err != nil {
+		return nil, &InvalidDataError{-1, frame.Id(), "Cannot decompress frame: " + err.String()}
+	}
+	defer r.Close()
+	content, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &InvalidDataError{-1, frame.Id(), "Cannot decompress frame: " + err.String()}
+	}
+	if length := frame.DataLengthIndicator(); length >= 0 && length != len(content) {
+		return nil, &InvalidDataError{-1, frame.Id(), "Decompressed frame length differs from data length indicator"}
+	}
+	return content, nil
+}
+
+// obsolete tells if the frame comes from an ID3v2.2 tag, with three
+// character IDs.
+func (frame *Frame) obsolete() bool {
+	return len(frame.Header) == OBSOLETE_FRAME_HEADER_LENGTH
+}
+
+func (frame *Frame) idLength() int {
+	if frame.obsolete() {
+		return 3
+	}
+	return 4
+}
+
 func (frame *Frame) Length() int {
 	return frame.DataLength() + len(frame.Header)
 }
@@ -61,13 +300,62 @@ func unpackInteger(b4 []byte) int32 {
 	return int32(b4[0])<<24 + int32(b4[1])<<16 + int32(b4[2])<<8 + int32(b4[3])
 }
 
-// TODO: unsynch=true, encoding!=0, stop reading on '\0'
-func textDecode(encoding byte, data []byte, unsynch bool) (string, os.Error) {
+// textDecode decodes the text in data, up to its terminator, to UTF-8.
+func textDecode(encoding byte, data []byte) (string, os.Error) {
+	data, _ = splitOnTerminator(encoding, data)
 	switch encoding {
-	case 0:
+	case ENCODING_ISO_8859_1:
+		units := make([]uint16, len(data))
+		for i, b := range data {
+			units[i] = uint16(b) // Latin-1 matches the first Unicode code points
+		}
+		return string(utf16.Decode(units)), nil
+	case ENCODING_UTF_16:
+		bigEndian := true // when there is no byte order mark
+		if len(data) >= 2 {
+			switch {
+			case data[0] == 0xfe && data[1] == 0xff:
+				data = data[2:]
+			case data[0] == 0xff && data[1] == 0xfe:
+				bigEndian = false
+				data = data[2:]
+			}
+		}
+		return utf16Decode(data, bigEndian), nil
+	case ENCODING_UTF_16BE:
+		return utf16Decode(data, true), nil
+	case ENCODING_UTF_8:
 		return string(data), nil
 	}
-	return "", os.NewError(fmt.Sprintf("unknown ID3v2 encoding %v", encoding))
+	return "", &InvalidDataError{Offset: -1, Message: fmt.Sprintf("unknown ID3v2 encoding %v", encoding)}
+}
+
+func utf16Decode(data []byte, bigEndian bool) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		b0, b1 := uint16(data[2*i]), uint16(data[2*i+1])
+		if bigEndian {
+			units[i] = b0<<8 | b1
+		} else {
+			units[i] = b1<<8 | b0
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// textDecodeList decodes the null separated values of a text frame.
+func textDecodeList(encoding byte, data []byte) ([]string, os.Error) {
+	values := make([]string, 0, 1)
+	for len(data) > 0 {
+		var x []byte
+		x, data = splitOnTerminator(encoding, data)
+		value, err := textDecode(encoding, x)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
 }
 
 type pictureData struct {
@@ -77,10 +365,9 @@ type pictureData struct {
 	ImageData   []byte
 }
 
-//TODO: check boundaries [? or does Go do it?]
 //TODO: handle error from textDecode
 func pictureUnpack(buf []byte) *pictureData {
-	if buf == nil {
+	if len(buf) < 1 {
 		return nil
 	}
 	data := new(pictureData)
@@ -88,11 +375,14 @@ func pictureUnpack(buf []byte) *pictureData {
 	enc := buf[0]
 
 	x, buf := splitOnZero(buf[1:])
+	if len(buf) < 1 {
+		return nil
+	}
 	data.MimeType = string(x)
 	data.PictureType = buf[0]
 
-	x, buf = splitOnZero(buf[1:])
-	data.Description, _ = textDecode(enc, x, false)
+	x, buf = splitOnTerminator(enc, buf[1:])
+	data.Description, _ = textDecode(enc, x)
 
 	x = buf
 	data.ImageData = make([]byte, len(x))
@@ -106,18 +396,17 @@ type urlData struct {
 	Url         string
 }
 
-//TODO: check boundaries [? or does Go do it?]
 //TODO: handle error from textDecode
 func urlUnpack(buf []byte) *urlData {
-	if buf == nil {
+	if len(buf) < 1 {
 		return nil
 	}
 	data := new(urlData)
 
 	enc := buf[0]
 
-	x, buf := splitOnZero(buf[1:])
-	data.Description, _ = textDecode(enc, x, false)
+	x, buf := splitOnTerminator(enc, buf[1:])
+	data.Description, _ = textDecode(enc, x)
 
 	x, _ = splitOnZero(buf)
 	data.Url = string(x)
@@ -132,7 +421,7 @@ type commentData struct {
 }
 
 func commentUnpack(buf []byte) *commentData {
-	if buf == nil {
+	if len(buf) < 4 {
 		return nil
 	}
 	d := new(commentData)
@@ -140,15 +429,28 @@ func commentUnpack(buf []byte) *commentData {
 	enc := buf[0]
 	d.Language = string(buf[1:4])
 
-	x, buf := splitOnZero(buf[4:])
-	d.Description, _ = textDecode(enc, x, false)
+	x, buf := splitOnTerminator(enc, buf[4:])
+	d.Description, _ = textDecode(enc, x)
 
-	x, _ = splitOnZero(buf)
-	d.Comment, _ = textDecode(enc, x, false)
+	d.Comment, _ = textDecode(enc, buf)
 
 	return d
 }
 
+// splitOnTerminator splits buf after the text it starts with, which UTF-16
+// encodings end with two aligned zero bytes, the others with one.
+func splitOnTerminator(encoding byte, buf []byte) (head, tail []byte) {
+	if encoding != ENCODING_UTF_16 && encoding != ENCODING_UTF_16BE {
+		return splitOnZero(buf)
+	}
+	for i := 0; i+1 < len(buf); i += 2 {
+		if buf[i] == 0 && buf[i+1] == 0 {
+			return buf[:i], buf[i+2:]
+		}
+	}
+	return buf, nil
+}
+
 func splitOnZero(buf []byte) (head, tail []byte) {
 	for i := 0; i < len(buf); i++ {
 		if buf[i] == 0 {
@@ -0,0 +1,339 @@
+package id3v2
+
+import (
+	"strconv"
+	"strings"
+)
+
+// special genre numbers of TCON frames
+const (
+	GENRE_NONE  = -1 // free text
+	GENRE_REMIX = -2 // "(RX)"
+	GENRE_COVER = -3 // "(CR)"
+)
+
+// Genre is one of the genres listed by a TCON frame.
+type Genre struct {
+	Number int    // the ID3v1 genre number, or one of the GENRE_ constants
+	Name   string // the name of the genre, or the free text
+}
+
+// genres lists the ID3v1 genres by number: 0 to 79 are standard, the
+// others are Winamp extensions. ID3v2 TCON frames refer to them as "(17)".
+// 136 to 141 are numbered as in earlier versions of this package, which
+// differ from Winamp's (e.g. 141 is "Christian Rock" in Winamp); from 142
+// on, Winamp's numbers are used, so that a few names are listed twice and
+// Winamp's 138 to 141 have none.
+var genres = [...]string{
+	"Blues",
+	"Classic Rock",
+	"Country",
+	"Dance",
+	"Disco",
+	"Funk",
+	"Grunge",
+	"Hip-Hop",
+	"Jazz",
+	"Metal",
+	"New Age",
+	"Oldies",
+	"Other",
+	"Pop",
+	"R&B",
+	"Rap",
+	"Reggae",
+	"Rock",
+	"Techno",
+	"Industrial",
+	"Alternative",
+	"Ska",
+	"Death Metal",
+	"Pranks",
+	"Soundtrack",
+	"Euro-Techno",
+	"Ambient",
+	"Trip-Hop",
+	"Vocal",
+	"Jazz+Funk",
+	"Fusion",
+	"Trance",
+	"Classical",
+	"Instrumental",
+	"Acid",
+	"House",
+	"Game",
+	"Sound Clip",
+	"Gospel",
+	"Noise",
+	"Alt Rock",
+	"Bass",
+	"Soul",
+	"Punk",
+	"Space",
+	"Meditative",
+	"Instrumental Pop",
+	"Instrumental Rock",
+	"Ethnic",
+	"Gothic",
+	"Darkwave",
+	"Techno-Industrial",
+	"Electronic",
+	"Pop-Folk",
+	"Eurodance",
+	"Dream",
+	"Southern Rock",
+	"Comedy",
+	"Cult",
+	"Gangsta",
+	"Top 40",
+	"Christian Rap",
+	"Pop/Funk",
+	"Jungle",
+	"Native American",
+	"Cabaret",
+	"New Wave",
+	"Psychedelic",
+	"Rave",
+	"Showtunes",
+	"Trailer",
+	"Lo-Fi",
+	"Tribal",
+	"Acid Punk",
+	"Acid Jazz",
+	"Polka",
+	"Retro",
+	"Musical",
+	"Rock & Roll",
+	"Hard Rock",
+	"Folk",
+	"Folk/Rock",
+	"National Folk",
+	"Swing",
+	"Fast Fusion",
+	"Bebob",
+	"Latin",
+	"Revival",
+	"Celtic",
+	"Bluegrass",
+	"Avantgarde",
+	"Gothic Rock",
+	"Progressive Rock",
+	"Psychedelic Rock",
+	"Symphonic Rock",
+	"Slow Rock",
+	"Big Band",
+	"Chorus",
+	"Easy Listening",
+	"Acoustic",
+	"Humour",
+	"Speech",
+	"Chanson",
+	"Opera",
+	"Chamber Music",
+	"Sonata",
+	"Symphony",
+	"Booty Bass",
+	"Primus",
+	"Porn Groove",
+	"Satire/Parody",
+	"Slow Jam",
+	"Club",
+	"Tango",
+	"Samba",
+	"Folklore",
+	"Ballad",
+	"Power Ballad",
+	"Rhythmic Soul",
+	"Freestyle",
+	"Duet",
+	"Punk Rock",
+	"Drum Solo",
+	"Acapella",
+	"Euro-House",
+	"Dance Hall",
+	"Goa",
+	"Drum & Bass",
+	"Club-House",
+	"Hardcore",
+	"Terror",
+	"Indie",
+	"BritPop",
+	"Negerpunk",
+	"Polsk Punk",
+	"Beat",
+	"Christian Gangsta",
+	"Heavy Metal",
+	"Thrash Metal",
+	"Anime",
+	"JPop",
+	"Synthpop",
+	"Merengue",
+	"Salsa",
+	"Thrash Metal",
+	"Anime",
+	"JPop",
+	"Synthpop",
+	"Abstract",
+	"Art Rock",
+	"Baroque",
+	"Bhangra",
+	"Big Beat",
+	"Breakbeat",
+	"Chillout",
+	"Downtempo",
+	"Dub",
+	"EBM",
+	"Eclectic",
+	"Electro",
+	"Electroclash",
+	"Emo",
+	"Experimental",
+	"Garage",
+	"Global",
+	"IDM",
+	"Illbient",
+	"Industro-Goth",
+	"Jam Band",
+	"Krautrock",
+	"Leftfield",
+	"Lounge",
+	"Math Rock",
+	"New Romantic",
+	"Nu-Breakz",
+	"Post-Punk",
+	"Post-Rock",
+	"Psytrance",
+	"Shoegaze",
+	"Space Rock",
+	"Trop Rock",
+	"World Music",
+	"Neoclassical",
+	"Audiobook",
+	"Audio Theatre",
+	"Neue Deutsche Welle",
+	"Podcast",
+	"Indie Rock",
+	"G-Funk",
+	"Dubstep",
+	"Garage Rock",
+	"Psybient"}
+
+var genreNumbers = make(map[string]int)
+
+func init() {
+	for i, name := range genres {
+		if _, ok := genreNumbers[strings.ToLower(name)]; !ok {
+			genreNumbers[strings.ToLower(name)] = i
+		}
+	}
+}
+
+// GenreName returns the name of the ID3v1 genre with the given number, or
+// "" if there is none.
+func GenreName(genre int) string {
+	if genre < 0 || genre >= len(genres) {
+		return ""
+	}
+	return genres[genre]
+}
+
+// GenreNumber returns the number of the ID3v1 genre with the given name,
+// ignoring case, or -1 if there is none.
+func GenreNumber(name string) int {
+	genre, ok := genreNumbers[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return -1
+	}
+	return genre
+}
+
+// parseGenres decodes the values of a TCON frame. ID3v2.3 lists references
+// to ID3v1 genres, "(RX)" and "(CR)", followed by a free text refinement
+// which starts with "((" if it starts with a bracket. ID3v2.4 lists them as
+// separate values, the references as "17", "RX" and "CR".
+func parseGenres(values []string) []Genre {
+	genres := make([]Genre, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if genre, ok := genreReference(value); ok {
+			genres = append(genres, genre)
+			continue
+		}
+		for strings.HasPrefix(value, "(") && !strings.HasPrefix(value, "((") {
+			end := strings.Index(value, ")")
+			if end < 0 {
+				break
+			}
+			genre, ok := genreReference(value[1:end])
+			if !ok {
+				break
+			}
+			genres = append(genres, genre)
+			value = value[end+1:]
+		}
+		if strings.HasPrefix(value, "((") {
+			value = value[1:]
+		}
+		if value == "" {
+			continue
+		}
+		// refinements often repeat the name of the genre they refine
+		last := len(genres) - 1
+		if last >= 0 && genres[last].Number >= 0 && strings.ToLower(genres[last].Name) == strings.ToLower(value) {
+			continue
+		}
+		genres = append(genres, Genre{GenreNumber(value), value}) // GENRE_NONE if unknown
+	}
+	return genres
+}
+
+// genreReference decodes "17", "RX" or "CR".
+func genreReference(ref string) (Genre, bool) {
+	switch ref {
+	case "RX":
+		return Genre{GENRE_REMIX, "Remix"}, true
+	case "CR":
+		return Genre{GENRE_COVER, "Cover"}, true
+	}
+	number, err := strconv.Atoi(ref)
+	if err != nil || number < 0 || number > 255 {
+		return Genre{}, false
+	}
+	return Genre{number, GenreName(number)}, true
+}
+
+// formatGenres encodes genres as the values of a TCON frame of the given
+// major version: a single value in ID3v2.2 and ID3v2.3 tags, which can only
+// hold one free text refinement, the first one.
+func formatGenres(genres []Genre, version int) []string {
+	values := make([]string, 0, len(genres))
+	text := ""
+	for _, genre := range genres {
+		ref := ""
+		switch {
+		case genre.Number == GENRE_REMIX:
+			ref = "RX"
+		case genre.Number == GENRE_COVER:
+			ref = "CR"
+		case genre.Number >= 0:
+			ref = strconv.Itoa(genre.Number)
+		}
+		switch {
+		case version == 4 && ref != "":
+			values = append(values, ref)
+		case version == 4:
+			values = append(values, genre.Name)
+		case ref != "":
+			values = append(values, "("+ref+")")
+		case text == "":
+			text = genre.Name
+		}
+	}
+	if version == 4 {
+		return values
+	}
+	if strings.HasPrefix(text, "(") {
+		text = "(" + text
+	}
+	return []string{strings.Join(values, "") + text}
+}
@@ -0,0 +1,125 @@
+package id3v2_test
+
+import (
+	"mp3agic/id3v2"
+	"testing"
+)
+
+func TestGenreLookup(t *testing.T) {
+	assert(t, id3v2.GenreName(0) == "Blues", "genre 0", id3v2.GenreName(0))
+	assert(t, id3v2.GenreName(17) == "Rock", "genre 17", id3v2.GenreName(17))
+	assert(t, id3v2.GenreName(147) == "Synthpop", "genre 147", id3v2.GenreName(147))
+	assert(t, id3v2.GenreName(191) == "Psybient", "genre 191", id3v2.GenreName(191))
+	assert(t, id3v2.GenreName(192) == "", "genre 192", id3v2.GenreName(192))
+	assert(t, id3v2.GenreName(-1) == "", "genre -1", id3v2.GenreName(-1))
+
+	assert(t, id3v2.GenreName(141) == "Synthpop", "genre 141", id3v2.GenreName(141))
+	assert(t, id3v2.GenreName(142) == "Merengue", "genre 142", id3v2.GenreName(142))
+
+	assert(t, id3v2.GenreNumber("Rock") == 17, "Rock", id3v2.GenreNumber("Rock"))
+	assert(t, id3v2.GenreNumber("Synthpop") == 141, "Synthpop", id3v2.GenreNumber("Synthpop"))
+	assert(t, id3v2.GenreNumber(" drum & bass ") == 127, "drum & bass", id3v2.GenreNumber(" drum & bass "))
+	assert(t, id3v2.GenreNumber("Eurodisco") == -1, "Eurodisco", id3v2.GenreNumber("Eurodisco"))
+}
+
+func TestResolveTagGenre(t *testing.T) {
+	tests := []struct {
+		tcon        string
+		genre       int
+		description string
+	}{
+		{"(17)", 17, "Rock"},
+		{"17", 17, "Rock"},
+		{"Rock", 17, "Rock"},
+		{"(17)Eurodisco", 17, "Eurodisco"},
+		{"Eurodisco", -1, "Eurodisco"}}
+	for _, test := range tests {
+		frames := v24Frame("TCON", "\x00\x00", "\x00"+test.tcon)
+		data := "ID3\x04\x00\x00" + synchsafe(len(frames)) + frames
+		tag, err := id3v2.ExtractTag(BufReaderAt(data))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		assert(t, tag.Genre() == test.genre, test.tcon, "genre expected", test.genre, "got", tag.Genre())
+		assert(t, tag.GenreDescription() == test.description, test.tcon, "genre description", tag.GenreDescription())
+	}
+}
+
+func genresTag(t *testing.T, version byte, tcon string) *id3v2.Tag {
+	frames := v24Frame("TCON", "\x00\x00", "\x00"+tcon)
+	if version == 3 {
+		frames = "TCON\x00\x00\x00" + string(byte(len(tcon)+1)) + "\x00\x00\x00" + tcon
+	}
+	data := "ID3" + string(version) + "\x00\x00" + synchsafe(len(frames)) + frames
+	tag, err := id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func TestReadGenres(t *testing.T) {
+	tests := []struct {
+		version byte
+		tcon    string
+		genres  []id3v2.Genre
+	}{
+		{3, "(17)(6)Eurodisco", []id3v2.Genre{{17, "Rock"}, {6, "Grunge"}, {id3v2.GENRE_NONE, "Eurodisco"}}},
+		{3, "(RX)(CR)", []id3v2.Genre{{id3v2.GENRE_REMIX, "Remix"}, {id3v2.GENRE_COVER, "Cover"}}},
+		{3, "(4)Disco", []id3v2.Genre{{4, "Disco"}}},
+		{3, "(31)((I think...)", []id3v2.Genre{{31, "Trance"}, {id3v2.GENRE_NONE, "(I think...)"}}},
+		{3, "Rock", []id3v2.Genre{{17, "Rock"}}},
+		{4, "17\x00RX\x00Eurodisco", []id3v2.Genre{{17, "Rock"}, {id3v2.GENRE_REMIX, "Remix"}, {id3v2.GENRE_NONE, "Eurodisco"}}},
+		{4, "(17)\x00Pop", []id3v2.Genre{{17, "Rock"}, {13, "Pop"}}}}
+	for _, test := range tests {
+		genres := genresTag(t, test.version, test.tcon).Genres()
+		ok := len(genres) == len(test.genres)
+		for i := 0; ok && i < len(genres); i++ {
+			ok = genres[i] == test.genres[i]
+		}
+		assert(t, ok, test.tcon, "genres expected", test.genres, "got", genres)
+	}
+}
+
+func TestWriteGenres(t *testing.T) {
+	genres := []id3v2.Genre{{17, "Rock"}, {id3v2.GENRE_COVER, "Cover"}, {id3v2.GENRE_NONE, "(Eurodisco)"}}
+	tests := []struct {
+		version int
+		tcon    []string
+	}{
+		{3, []string{"(17)(CR)((Eurodisco)"}},
+		{4, []string{"17", "CR", "(Eurodisco)"}}}
+	for _, test := range tests {
+		tag := id3v2.NewTag(test.version)
+		tag.SetGenres(genres)
+		values := tag.TextValues("TCON")
+		ok := len(values) == len(test.tcon)
+		for i := 0; ok && i < len(values); i++ {
+			ok = values[i] == test.tcon[i]
+		}
+		assert(t, ok, "version", test.version, "TCON expected", test.tcon, "got", values)
+		assert(t, len(tag.Genres()) == 3 && tag.Genres()[2] == genres[2], "genres", tag.Genres())
+	}
+
+	// ID3v2.3 tags hold a single free text genre
+	tag := id3v2.NewTag(3)
+	tag.SetGenres([]id3v2.Genre{{id3v2.GENRE_NONE, "Synth/Wave"}, {id3v2.GENRE_NONE, "Eurodisco"}})
+	values := tag.TextValues("TCON")
+	assert(t, len(values) == 1 && values[0] == "Synth/Wave", "v2.3 TCON", values)
+	read := tag.Genres()
+	assert(t, len(read) == 1 && read[0] == id3v2.Genre{id3v2.GENRE_NONE, "Synth/Wave"}, "genres", read)
+
+	// converted when written in another version
+	tag = genresTag(t, 4, "17\x006\x00Eurodisco")
+	written := rewrite(t, tag, 3, nil)
+	if written != nil {
+		values := written.TextValues("TCON")
+		assert(t, len(values) == 1 && values[0] == "(17)(6)Eurodisco", "v2.3 TCON", values)
+		written = rewrite(t, written, 4, nil)
+	}
+	if written != nil {
+		values := written.TextValues("TCON")
+		assert(t, len(values) == 3 && values[0] == "17" && values[2] == "Eurodisco", "v2.4 TCON", values)
+	}
+}
@@ -0,0 +1,156 @@
+package id3v2
+
+import (
+	"strings"
+)
+
+// obsoleteFrameIds maps the IDs of ID3v2.3 frames to the three character
+// IDs of the matching ID3v2.2 frames. The ID3v2.2 CRM (encrypted meta) and
+// LNK (linked information, which refers to three character IDs) frames
+// have no counterpart.
+var obsoleteFrameIds = map[string]string{
+	"AENC": "CRA",
+	"APIC": "PIC",
+	"COMM": "COM",
+	"EQUA": "EQU",
+	"ETCO": "ETC",
+	"GEOB": "GEO",
+	"IPLS": "IPL",
+	"MCDI": "MCI",
+	"MLLT": "MLL",
+	"PCNT": "CNT",
+	"POPM": "POP",
+	"RBUF": "BUF",
+	"RVAD": "RVA",
+	"RVRB": "REV",
+	"SYLT": "SLT",
+	"SYTC": "STC",
+	"TALB": "TAL",
+	"TBPM": "TBP",
+	"TCOM": "TCM",
+	"TCON": "TCO",
+	"TCOP": "TCR",
+	"TDAT": "TDA",
+	"TDLY": "TDY",
+	"TENC": "TEN",
+	"TEXT": "TXT",
+	"TFLT": "TFT",
+	"TIME": "TIM",
+	"TIT1": "TT1",
+	"TIT2": "TT2",
+	"TIT3": "TT3",
+	"TKEY": "TKE",
+	"TLAN": "TLA",
+	"TLEN": "TLE",
+	"TMED": "TMT",
+	"TOAL": "TOT",
+	"TOFN": "TOF",
+	"TOLY": "TOL",
+	"TOPE": "TOA",
+	"TORY": "TOR",
+	"TPE1": "TP1",
+	"TPE2": "TP2",
+	"TPE3": "TP3",
+	"TPE4": "TP4",
+	"TPOS": "TPA",
+	"TPUB": "TPB",
+	"TRCK": "TRK",
+	"TRDA": "TRD",
+	"TSIZ": "TSI",
+	"TSRC": "TRC",
+	"TSSE": "TSS",
+	"TXXX": "TXX",
+	"TYER": "TYE",
+	"UFID": "UFI",
+	"USLT": "ULT",
+	"WCOM": "WCM",
+	"WCOP": "WCP",
+	"WOAF": "WAF",
+	"WOAR": "WAR",
+	"WOAS": "WAS",
+	"WPUB": "WPB",
+	"WXXX": "WXX",
+}
+
+// upgradedFrameIds maps the IDs of ID3v2.2 frames to the IDs of the
+// matching ID3v2.3 frames.
+var upgradedFrameIds = make(map[string]string)
+
+func init() {
+	for id, obsoleteId := range obsoleteFrameIds {
+		upgradedFrameIds[obsoleteId] = id
+	}
+}
+
+// upgrade returns an ID3v2.3 tag holding the frames of an ID3v2.2 tag,
+// less those without an ID3v2.3 counterpart. PIC frames are converted to
+// APIC frames.
+func (tag *Tag) upgrade() *Tag {
+	upgraded := NewTag(3)
+	for _, obsoleteId := range tag.frameIds {
+		id, ok := upgradedFrameIds[obsoleteId]
+		if !ok {
+			continue
+		}
+		for _, frame := range tag.frameSets[obsoleteId] {
+			data := frame.Data
+			if id == "APIC" && len(data) >= 4 {
+				mimeType := obsoleteMimeType(string(data[1:4]))
+				data = append(append([]byte{data[0]}, mimeType+"\x00"...), data[4:]...)
+			}
+			if _, ok := upgraded.frameSets[id]; !ok {
+				upgraded.frameIds = append(upgraded.frameIds, id)
+			}
+			upgraded.frameSets[id] = append(upgraded.frameSets[id], newFrame(id, 3, 0, data))
+		}
+	}
+	return upgraded
+}
+
+// obsoletePictureUnpack decodes a PIC frame, which differs from APIC by
+// giving a three character image format instead of a MIME type.
+func obsoletePictureUnpack(buf []byte) *pictureData {
+	if len(buf) < 5 {
+		return nil
+	}
+	data := new(pictureData)
+
+	enc := buf[0]
+	data.MimeType = obsoleteMimeType(string(buf[1:4]))
+	data.PictureType = buf[4]
+
+	x, buf := splitOnTerminator(enc, buf[5:])
+	data.Description, _ = textDecode(enc, x)
+
+	data.ImageData = make([]byte, len(buf))
+	copy(data.ImageData, buf)
+
+	return data
+}
+
+func obsoleteMimeType(format string) string {
+	format = strings.ToLower(strings.TrimRight(format, "\x00 "))
+	switch format {
+	case "":
+		return ""
+	case "jpg":
+		format = "jpeg"
+	case "-->":
+		return format // the data is a URL
+	}
+	return "image/" + format
+}
+
+// obsoleteImageFormat gives the three character image format of a PIC
+// frame for a MIME type.
+func obsoleteImageFormat(mimeType string) string {
+	format := mimeType
+	if strings.HasPrefix(format, "image/") {
+		format = format[len("image/"):]
+	}
+	format = strings.ToUpper(format)
+	if format == "JPEG" {
+		format = "JPG"
+	}
+	return (format + "   ")[:3]
+}
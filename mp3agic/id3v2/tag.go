@@ -1,43 +1,54 @@
 package id3v2
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
-	"regexp"
 	"strconv"
-	"strings"
-)
-
-var (
-	genrePattern = regexp.MustCompile(`^\(([^\)]+)\)(.*)`)
 )
 
 type Tag struct {
 	header         *TagHeader
 	extendedHeader []byte
 	frameSets      map[string][]*Frame
+	frameIds       []string // in the order of their first frame
 }
 
-func ExtractTag(mp3stream io.ReadSeeker) (*Tag, os.Error) {
-	tag := Tag{}
-	var err os.Error
-
-	tag.header, err = ExtractTagHeader(mp3stream)
+// ExtractTag reads the ID3v2 tag found at the start of mp3stream. If the
+// tag is damaged, the frames before the damage are returned along with an
+// *InvalidDataError.
+func ExtractTag(mp3stream io.ReaderAt) (*Tag, os.Error) {
+	header, err := ExtractTagHeader(mp3stream)
 	if err != nil {
 		return nil, err
 	}
+	var body io.Reader = io.NewSectionReader(mp3stream, int64(len(header)), int64(header.DataLength()))
+	if header.Unsynchronisation() && header.MajorVersion() < 4 {
+		// the whole tag must be resynchronised before the frames can be
+		// found; ID3v2.4 unsynchronises each frame on its own instead
+		data := make([]byte, header.DataLength())
+		readn, _ := io.ReadFull(body, data)
+		body = bytes.NewBuffer(resynchronise(data[:readn]))
+	}
+	return extractTagBody(header, body)
+}
+
+func extractTagBody(header *TagHeader, body io.Reader) (*Tag, os.Error) {
+	tag := Tag{header: header}
+	offset := int64(len(header))
 
 	if tag.header.ExtendedHeader() {
-		err = tag.extractExtendedHeader(mp3stream)
+		err := tag.extractExtendedHeader(body)
 		if err != nil {
-			return nil, err
+			return nil, &InvalidDataError{Offset: offset, Message: "Extended header truncated"}
 		}
+		offset += 4 + int64(len(tag.extendedHeader))
 	}
 
-	err = tag.extractFrameSets(mp3stream)
+	err := tag.extractFrameSets(body, offset)
 	if err != nil {
-		return nil, err
+		return &tag, err
 	}
 
 	// TODO: extract footer
@@ -49,12 +60,18 @@ func (tag *Tag) Version() string {
 	return strconv.Itoa(tag.header.MajorVersion()) + "." + strconv.Itoa(tag.header.MinorVersion())
 }
 
+func (tag *Tag) MajorVersion() int {
+	return tag.header.MajorVersion()
+}
+
 func (tag *Tag) DataLength() int {
 	return tag.header.DataLength()
 }
 
+// Length returns the length of the whole tag, including its header and
+// footer.
 func (tag *Tag) Length() int {
-	return tag.DataLength() + len(tag.header)
+	return tag.header.TagLength()
 }
 
 func (tag *Tag) Track() string {
@@ -73,38 +90,61 @@ func (tag *Tag) Album() string {
 	return tag.textFrameData("TALB")
 }
 
+// Year returns the year of recording, which ID3v2.4 tags only give as
+// part of the recording time.
 func (tag *Tag) Year() string {
-	return tag.textFrameData("TYER")
+	year := tag.textFrameData("TYER")
+	if year == "" && len(tag.RecordingTime()) >= 4 {
+		year = tag.RecordingTime()[:4]
+	}
+	return year
+}
+
+// RecordingTime returns the ID3v2.4 recording time, a timestamp such as
+// "2011-03-04T10:30" of which only the leading "yyyy" part is required.
+func (tag *Tag) RecordingTime() string {
+	return tag.textFrameData("TDRC")
 }
 
+// OriginalReleaseTime returns the ID3v2.4 original release time, or the
+// original release year of older tags.
+func (tag *Tag) OriginalReleaseTime() string {
+	time := tag.textFrameData("TDOR")
+	if time == "" {
+		time = tag.textFrameData("TORY")
+	}
+	return time
+}
+
+// Genre returns the number of the first ID3v1 genre given by the TCON
+// frame, such as "(17)", "17" or "Rock", or -1.
 func (tag *Tag) Genre() int {
-	raw := strings.TrimSpace(tag.textFrameData("TCON"))
-	if raw == "" {
-		return -1
-	}
-	m := genrePattern.FindStringSubmatch(raw)
-	if len(m) >= 2 {
-		genre, err := strconv.Atoi(m[1])
-		if err == nil {
-			return genre
+	for _, genre := range tag.Genres() {
+		if genre.Number >= 0 {
+			return genre.Number
 		}
-		// TODO: search genre number by name in standard table/map
-	}
-	genre, err := strconv.Atoi(raw)
-	if err == nil {
-		return genre
 	}
 	return -1
 }
 
+// GenreDescription returns the free text of the TCON frame, such as
+// "Eurodisco" in "(17)Eurodisco", or else the name of the first genre.
 func (tag *Tag) GenreDescription() string {
-	raw := strings.TrimSpace(tag.textFrameData("TCON"))
-	m := genrePattern.FindStringSubmatch(raw)
-	if len(m) >= 3 {
-		return m[2]
+	genres := tag.Genres()
+	for _, genre := range genres {
+		if genre.Number == GENRE_NONE {
+			return genre.Name
+		}
+	}
+	if len(genres) == 0 {
+		return ""
 	}
-	return raw
-	// TODO: search genre name by number in standard table
+	return genres[0].Name
+}
+
+// Genres returns the genres listed by the TCON frame, in order.
+func (tag *Tag) Genres() []Genre {
+	return parseGenres(tag.TextValues("TCON"))
 }
 
 func (tag *Tag) Comment() string {
@@ -115,6 +155,22 @@ func (tag *Tag) Comment() string {
 	return d.Comment
 }
 
+// CommentByDescription returns the text of the first COMM frame with the
+// given description, such as "iTunNORM" or "iTunSMPB".
+func (tag *Tag) CommentByDescription(description string) string {
+	for _, frame := range tag.frameSet("COMM") {
+		content, err := frame.Content()
+		if err != nil {
+			continue
+		}
+		d := commentUnpack(content)
+		if d != nil && d.Description == description {
+			return d.Comment
+		}
+	}
+	return ""
+}
+
 func (tag *Tag) Composer() string {
 	return tag.textFrameData("TCOM")
 }
@@ -140,7 +196,7 @@ func (tag *Tag) Encoder() string {
 }
 
 func (tag *Tag) AlbumImage() []byte {
-	pict := pictureUnpack(tag.frameData("APIC"))
+	pict := tag.picture()
 	if pict == nil {
 		return make([]byte, 0)
 	}
@@ -148,40 +204,94 @@ func (tag *Tag) AlbumImage() []byte {
 }
 
 func (tag *Tag) AlbumImageMimeType() string {
-	pict := pictureUnpack(tag.frameData("APIC"))
+	pict := tag.picture()
 	if pict == nil {
 		return ""
 	}
 	return pict.MimeType
 }
 
+func (tag *Tag) picture() *pictureData {
+	if tag.obsolete() {
+		return obsoletePictureUnpack(tag.frameData("APIC"))
+	}
+	return pictureUnpack(tag.frameData("APIC"))
+}
+
 func (tag *Tag) textFrameData(id string) string {
 	data := tag.frameData(id)
-	if data == nil {
+	if len(data) == 0 {
 		return ""
 	}
-	text, err := textDecode(data[0], data[1:], false)
+	text, err := textDecode(data[0], data[1:])
 	if err != nil {
 		return ""
 	}
 	return string(text)
 }
 
+// TextValues returns all the values of the first text frame with the
+// given ID. ID3v2.4 text frames may hold several values, separated by
+// null characters; the other getters only return the first one.
+func (tag *Tag) TextValues(id string) []string {
+	data := tag.frameData(id)
+	if len(data) == 0 {
+		return nil
+	}
+	values, err := textDecodeList(data[0], data[1:])
+	if err != nil {
+		return nil
+	}
+	return values
+}
+
 func (tag *Tag) frameData(id string) []byte {
-	fs, ok := tag.frameSets[id]
-	if !ok {
+	fs := tag.frameSet(id)
+	if len(fs) == 0 {
+		return nil
+	}
+	content, err := fs[0].Content()
+	if err != nil {
 		return nil
 	}
-	return fs[0].Data
+	return content
+}
+
+// frameSet returns the frames with the given ID3v2.3 ID, or with the
+// matching ID3v2.2 ID in an ID3v2.2 tag.
+func (tag *Tag) frameSet(id string) []*Frame {
+	return tag.frameSets[tag.frameId(id)]
+}
+
+// frameId translates an ID3v2.3 frame ID to the ID used by the tag, which
+// is empty if an ID3v2.2 tag cannot hold the frame.
+func (tag *Tag) frameId(id string) string {
+	if tag.obsolete() {
+		return obsoleteFrameIds[id]
+	}
+	return id
+}
+
+// obsolete tells if the tag is an ID3v2.2 tag, with three character frame
+// IDs.
+func (tag *Tag) obsolete() bool {
+	return tag.header.MajorVersion() == 2
 }
 
-func (tag *Tag) extractExtendedHeader(mp3stream io.ReadSeeker) os.Error {
+func (tag *Tag) extractExtendedHeader(mp3stream io.Reader) os.Error {
 	var lengthBuf [4]byte
 	err := readStream(mp3stream, lengthBuf[:])
 	if err != nil {
 		return err
 	}
-	length := int(unpackSynchsafeInteger(lengthBuf[:]))
+	// the ID3v2.4 size is synchsafe and counts the size field itself
+	length := int(unpackInteger(lengthBuf[:]))
+	if tag.header.MajorVersion() == 4 {
+		length = int(unpackSynchsafeInteger(lengthBuf[:])) - len(lengthBuf)
+	}
+	if length < 0 {
+		return os.EOF
+	}
 
 	data := make([]byte, length)
 	err = readStream(mp3stream, data)
@@ -192,30 +302,31 @@ func (tag *Tag) extractExtendedHeader(mp3stream io.ReadSeeker) os.Error {
 	return nil
 }
 
-// TODO: v2.2, v2.4
-func (tag *Tag) extractFrameSets(mp3stream io.ReadSeeker) os.Error {
-	//startOffset, err := mp3stream.Seek(0, 1) // remember current offset
-	//if err != nil {
-	//	return err
-	//}
-
-	framesLen := int64(tag.DataLength())
-	if tag.header.Footer() {
-		framesLen -= 10
-	}
+// extractFrameSets reads the frames of the tag, the first of which is
+// found at the given offset in the stream. Reading stops without error at
+// the padding or at the end of the stream.
+func (tag *Tag) extractFrameSets(mp3stream io.Reader, offset int64) os.Error {
+	framesLen := int64(tag.DataLength()) - (offset - int64(len(tag.header)))
 
 	tag.frameSets = make(map[string][]*Frame)
 	fss := tag.frameSets
 	for readn := int64(0); readn < framesLen; {
-		frame, err := extractFrame(mp3stream)
-		if err != nil {
+		frame, err := extractFrame(mp3stream, offset+readn, tag.header.MajorVersion(), framesLen-readn)
+		if err == os.EOF || err == errPadding {
 			break
 		}
+		if err != nil {
+			return err
+		}
+		if frame.Unsynchronised() || tag.header.Unsynchronisation() && frame.Version == 4 {
+			frame.Data = resynchronise(frame.Data)
+		}
 
 		readn += int64(frame.Length())
 		frameset, ok := fss[frame.Id()]
 		if !ok {
 			frameset = make([]*Frame, 0)
+			tag.frameIds = append(tag.frameIds, frame.Id())
 		}
 		fss[frame.Id()] = append(frameset, frame)
 	}
@@ -227,21 +338,27 @@ func (tag *Tag) FrameSets() map[string][]*Frame {
 	return tag.frameSets
 }
 
+// FrameIds returns the IDs of the frames of the tag, in the order in which
+// they were first found or set.
+func (tag *Tag) FrameIds() []string {
+	return tag.frameIds
+}
+
 type TagHeader [10]byte
 
 const (
 	id3v2tag_magic = "ID3"
 )
 
-func ExtractTagHeader(mp3stream io.ReadSeeker) (*TagHeader, os.Error) {
-	_, err := mp3stream.Seek(0, 0)
-	if err != nil {
-		return nil, err
-	}
-
+// ExtractTagHeader reads the ID3v2 tag header found at the start of
+// mp3stream.
+func ExtractTagHeader(mp3stream io.ReaderAt) (*TagHeader, os.Error) {
 	var header TagHeader
-	err = readStream(mp3stream, header[:])
-	if err != nil {
+	readn, err := mp3stream.ReadAt(header[:], 0)
+	if readn != len(header) {
+		if err == nil || err == os.EOF {
+			err = &NoSuchTagError{"stream too short for ID3v2 tag"}
+		}
 		return nil, err
 	}
 
@@ -255,21 +372,25 @@ func ExtractTagHeader(mp3stream io.ReadSeeker) (*TagHeader, os.Error) {
 
 func (header *TagHeader) Validate() os.Error {
 	if string(header[:len(id3v2tag_magic)]) != id3v2tag_magic {
-		return os.NewError("stream does not start with ID3v2 magic code")
+		return &NoSuchTagError{"stream does not start with ID3v2 magic code"}
 	}
 
 	vmajor := header.MajorVersion()
+	version := fmt.Sprintf("%d.%d", vmajor, header.MinorVersion())
 	if vmajor != 2 && vmajor != 3 && vmajor != 4 {
-		return os.NewError(fmt.Sprintf("unsupported ID3 version 2.%d.%d", vmajor, header.MinorVersion()))
+		return &UnsupportedTagError{version, "unsupported ID3 version 2." + version}
 	}
 
 	flags := header.flags()
 	if flags&0x0f != 0 {
-		return os.NewError("unrecognized flags")
+		return &UnsupportedTagError{version, "unrecognized flags"}
+	}
+	if vmajor == 2 && flags&(1<<6) != 0 {
+		return &UnsupportedTagError{version, "compressed ID3v2.2 tag"}
 	}
 
 	if header.DataLength() < 1 {
-		return os.NewError("zero size tag")
+		return &InvalidDataError{Offset: 6, Message: "zero size tag"}
 	}
 
 	return nil // ok
@@ -291,10 +412,26 @@ func (header *TagHeader) DataLength() int {
 	return int(unpackSynchsafeInteger(header[6:10]))
 }
 
+// TagLength returns the length of the whole tag: the header, the data and
+// the footer if there is one.
+func (header *TagHeader) TagLength() int {
+	length := len(header) + header.DataLength()
+	if header.Footer() {
+		length += len(header)
+	}
+	return length
+}
+
+// Unsynchronisation tells if the unsynchronisation scheme was applied to
+// the tag: to all of it in ID3v2.2 and ID3v2.3 tags, to all of its frames
+// in ID3v2.4 tags.
+func (header *TagHeader) Unsynchronisation() bool {
+	return header.flags()&(1<<7) != 0
+}
+
 func (header *TagHeader) ExtendedHeader() bool {
 	switch header.version() {
-	case 0x30:
-	case 0x40:
+	case 0x300, 0x400:
 		return header.flags()&(1<<6) != 0
 	}
 	return false
@@ -302,7 +439,7 @@ func (header *TagHeader) ExtendedHeader() bool {
 
 func (header *TagHeader) Footer() bool {
 	switch header.version() {
-	case 0x40:
+	case 0x400:
 		return header.flags()&(1<<4) != 0
 	}
 	return false
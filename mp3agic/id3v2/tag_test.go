@@ -2,9 +2,12 @@ package id3v2_test
 
 import (
 	asrt "assert"
+	"bytes"
 	"io"
+	"io/ioutil"
 	"mp3agic/id3v2"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -84,6 +87,38 @@ func TestNonSupportedVersionInId3v2HeaderBlock(t *testing.T) {
 	buf[4] = 0
 	_, err := id3v2.ExtractTag(reader)
 	assert(t, err != nil, "expected error (wrong ID3v2 version), got nil")
+	e, ok := err.(*id3v2.UnsupportedTagError)
+	assert(t, ok, "expected UnsupportedTagError, got", err)
+	assert(t, ok && e.Version == "5.0", "version expected 5.0, got", e)
+}
+
+func TestNoId3v2Tag(t *testing.T) {
+	_, reader := bufWrap("TAG\x04\x00\x00\x00\x00\x02\x01")
+	_, err := id3v2.ExtractTag(reader)
+	_, ok := err.(*id3v2.NoSuchTagError)
+	assert(t, ok, "expected NoSuchTagError, got", err)
+
+	_, reader = bufWrap("ID3")
+	_, err = id3v2.ExtractTag(reader)
+	_, ok = err.(*id3v2.NoSuchTagError)
+	assert(t, ok, "expected NoSuchTagError, got", err)
+}
+
+func TestDamagedFrame(t *testing.T) {
+	data, err := ioutil.ReadFile(RES_DIR + "v1andv23tags.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[52] = 'w' // WXXX, the second frame
+	tag, err := id3v2.ExtractTag(BufReaderAt(data))
+	e, ok := err.(*id3v2.InvalidDataError)
+	assert(t, ok, "expected InvalidDataError, got", err)
+	if !ok {
+		return
+	}
+	assert(t, e.Offset == 52, "offset expected 52, got", e.Offset)
+	assert(t, e.FrameId == "wXXX", "frame id expected wXXX, got", e.FrameId)
+	assert(t, tag != nil && tag.Encoder() == "ENCODER234567890123456789012345", "frames before the damage expected")
 }
 
 func loadId3TagFile(fname string) (*id3v2.Tag, os.Error) {
@@ -173,3 +208,161 @@ func TestReadTagFieldsFromMp3With32tag(t *testing.T) {
 	assert(t, len(tag.AlbumImage()) == 1885, "len(album image)", len(tag.AlbumImage()))
 	assert(t, tag.AlbumImageMimeType() == "image/png", "album image mime type", tag.AlbumImageMimeType())
 }
+
+func synchsafe(n int) string {
+	return string([]byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)})
+}
+
+func v24Frame(id string, flags string, data string) string {
+	return id + synchsafe(len(data)) + flags + data
+}
+
+func TestReadFrameLongerThanTag(t *testing.T) {
+	for _, size := range []string{"\x00\x00\x01\x00", "\x7f\xff\xff\xff", "\xff\xff\xff\xff"} {
+		frames := "TIT2" + size + "\x00\x00\x00Title"
+		_, err := id3v2.ExtractTag(BufReaderAt("ID3\x03\x00\x00" + synchsafe(len(frames)) + frames))
+		e, ok := err.(*id3v2.InvalidDataError)
+		assert(t, ok && e.FrameId == "TIT2" && e.Offset == 10, "InvalidDataError for TIT2 expected, got", err)
+	}
+}
+
+func TestReadId3v24Frames(t *testing.T) {
+	title := strings.Repeat("T", 199)
+	frames := v24Frame("TIT2", "\x00\x00", "\x00"+title) +
+		v24Frame("TPE1", "\x00\x00", "\x00A\x00B") +
+		v24Frame("TDRC", "\x00\x00", "\x002011-03-04T10:30") +
+		v24Frame("TALB", "\x00\x01", synchsafe(6)+"\x00Album") +
+		"\x00\x00\x00\x00"
+	data := "ID3\x04\x00\x00" + synchsafe(len(frames)) + frames
+	tag, err := id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert(t, tag.Title() == title, "title", tag.Title())
+	assert(t, tag.Artist() == "A", "artist expected A, got", tag.Artist())
+	values := tag.TextValues("TPE1")
+	assert(t, len(values) == 2 && values[0] == "A" && values[1] == "B", "artists expected [A B], got", values)
+	assert(t, tag.RecordingTime() == "2011-03-04T10:30", "recording time", tag.RecordingTime())
+	assert(t, tag.Year() == "2011", "year expected 2011, got", tag.Year())
+	assert(t, tag.Album() == "Album", "album expected Album, got", tag.Album())
+
+	album := tag.FrameSets()["TALB"][0]
+	assert(t, album.HasDataLengthIndicator(), "data length indicator expected")
+	assert(t, album.DataLengthIndicator() == 6, "data length indicator expected 6, got", album.DataLengthIndicator())
+	assert(t, !album.Compressed() && !album.Grouping(), "no compression nor grouping expected")
+	assert(t, tag.FrameSets()["TIT2"][0].DataLengthIndicator() == -1, "no data length indicator expected")
+}
+
+func TestId3v24FrameFlags(t *testing.T) {
+	tag, err := loadId3TagFile("v1andv24tags.mp3")
+	if err != nil {
+		t.Error("error loading file:", err)
+		return
+	}
+	encoder := tag.FrameSets()["TENC"][0]
+	assert(t, encoder.TagAlterPreservation(), "tag alter preservation expected")
+	assert(t, !encoder.FileAlterPreservation(), "file alter preservation not expected")
+	assert(t, tag.Encoder() == "ENCODER234567890123456789012345", "encoder", tag.Encoder())
+	assert(t, tag.Title() == "TITLE1234567890123456789012345", "title", tag.Title())
+}
+
+func utf16Text(s string, bigEndian bool) string {
+	buf := make([]byte, 0, 2*len(s))
+	for _, c := range s {
+		if bigEndian {
+			buf = append(buf, byte(uint16(c)>>8), byte(c))
+		} else {
+			buf = append(buf, byte(c), byte(uint16(c)>>8))
+		}
+	}
+	return string(buf)
+}
+
+func TestReadTextEncodings(t *testing.T) {
+	bom := "\xff\xfe"
+	frames := v24Frame("TPE1", "\x00\x00", "\x01"+bom+utf16Text("Ärtist", false)+"\x00\x00"+bom+utf16Text("B", false)) +
+		v24Frame("TIT2", "\x00\x00", "\x02"+utf16Text("Tïtle", true)+"\x00\x00") +
+		v24Frame("TALB", "\x00\x00", "\x03Albüm\x00") +
+		v24Frame("TCOM", "\x00\x00", "\x00Caf\xe9") +
+		v24Frame("COMM", "\x00\x00", "\x01eng"+bom+utf16Text("A", false)+"\x00\x00"+bom+utf16Text("Cömment", false)) +
+		v24Frame("APIC", "\x00\x00", "\x01image/png\x00\x03"+bom+utf16Text("A", false)+"\x00\x00\x89PNG\x00\x00")
+	data := "ID3\x04\x00\x00" + synchsafe(len(frames)) + frames
+	tag, err := id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert(t, tag.Artist() == "Ärtist", "artist", tag.Artist())
+	values := tag.TextValues("TPE1")
+	assert(t, len(values) == 2 && values[1] == "B", "artists expected [Ärtist B], got", values)
+	assert(t, tag.Title() == "Tïtle", "title", tag.Title())
+	assert(t, tag.Album() == "Albüm", "album", tag.Album())
+	assert(t, tag.Composer() == "Café", "composer", tag.Composer())
+	assert(t, tag.Comment() == "Cömment", "comment", tag.Comment())
+	assert(t, tag.CommentByDescription("A") == "Cömment", "comment by description")
+	assert(t, tag.AlbumImageMimeType() == "image/png", "album image mime type", tag.AlbumImageMimeType())
+	assert(t, string(tag.AlbumImage()) == "\x89PNG\x00\x00", "album image", tag.AlbumImage())
+}
+
+func TestReadUnsynchronisedTags(t *testing.T) {
+	image, err := ioutil.ReadFile(RES_DIR + "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filename string
+		title    string
+	}{
+		{"v23unsynchronisedimage.mp3", "UNSYNC23"},
+		{"v24unsynchronisedimage.mp3", "UNSYNC24"}}
+	for _, test := range tests {
+		tag, err := loadId3TagFile(test.filename)
+		if err != nil {
+			t.Error(test.filename, "error loading file:", err)
+			continue
+		}
+		assert(t, tag.Title() == test.title, test.filename, "title", tag.Title())
+		assert(t, tag.AlbumImageMimeType() == "image/png", test.filename, "album image mime type", tag.AlbumImageMimeType())
+		assert(t, bytes.Equal(tag.AlbumImage(), image), test.filename, "album image differs from image.png")
+	}
+}
+
+const compressedTitle = "x\x9ccp\xce\xcf-(J-.NMQ(\xc9,\xc9I\xd5QH&(\x02\x00\r\xd1\x13\xde"
+
+func TestReadFrameFlags(t *testing.T) {
+	title := "Compressed title, compressed title, compressed title"
+	frames := v24Frame("TIT2", "\x00\x09", synchsafe(53)+compressedTitle) +
+		v24Frame("TALB", "\x00\x41", "\x05"+synchsafe(6)+"\x00Album") +
+		v24Frame("TPE1", "\x00\x04", "\x80\x17\x2a\x99")
+	data := "ID3\x04\x00\x00" + synchsafe(len(frames)) + frames
+	tag, err := id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert(t, tag.Title() == title, "title", tag.Title())
+	assert(t, tag.Album() == "Album", "album expected Album, got", tag.Album())
+	assert(t, tag.Artist() == "", "encrypted artist expected to be left alone, got", tag.Artist())
+
+	fs := tag.FrameSets()
+	assert(t, fs["TIT2"][0].Compressed(), "compressed title expected")
+	assert(t, fs["TALB"][0].GroupId() == 5, "group id expected 5, got", fs["TALB"][0].GroupId())
+	assert(t, fs["TIT2"][0].GroupId() == -1, "no group id expected")
+	artist := fs["TPE1"][0]
+	assert(t, artist.EncryptionMethod() == 0x80, "encryption method expected 0x80, got", artist.EncryptionMethod())
+	content, err := artist.Content()
+	e, ok := err.(*id3v2.EncryptedFrameError)
+	assert(t, ok && e.Method == 0x80 && e.FrameId == "TPE1", "EncryptedFrameError expected, got", err)
+	assert(t, string(content) == "\x17\x2a\x99", "encrypted content expected as is, got", content)
+
+	// ID3v2.3 puts the decompressed size before the compressed data
+	frames = "TIT2\x00\x00\x00\x22\x00\x80\x00\x00\x00\x35" + compressedTitle
+	data = "ID3\x03\x00\x00" + synchsafe(len(frames)) + frames
+	tag, err = id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert(t, tag.Title() == title, "v2.3 title", tag.Title())
+}
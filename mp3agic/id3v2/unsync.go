@@ -0,0 +1,29 @@
+package id3v2
+
+// resynchronise reverses the unsynchronisation scheme, by dropping the
+// zero byte inserted after each 0xff.
+func resynchronise(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// unsynchronise applies the unsynchronisation scheme to data, so that it
+// holds no false MPEG frame sync: a zero byte is inserted after each 0xff
+// followed by a byte which is either zero or has its three top bits set,
+// and after a trailing 0xff.
+func unsynchronise(data []byte) []byte {
+	out := make([]byte, 0, len(data)+len(data)/32)
+	for i, b := range data {
+		out = append(out, b)
+		if b == 0xff && (i+1 == len(data) || data[i+1] == 0 || data[i+1]&0xe0 == 0xe0) {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
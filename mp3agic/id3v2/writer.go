@@ -0,0 +1,551 @@
+package id3v2
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	MAX_TAG_DATA_LENGTH = 1<<28 - 1 // the largest synchsafe size
+)
+
+// WriteOptions tune how a tag is serialized by Tag.Bytes. A nil
+// *WriteOptions selects the defaults.
+type WriteOptions struct {
+	// Padding is the number of zero bytes written after the frames, so
+	// that the tag can later grow without moving the audio data.
+	Padding int
+
+	// Footer appends an ID3v2.4 footer, which excludes padding.
+	Footer bool
+
+	// Unsynchronisation applies the unsynchronisation scheme, for old
+	// players which would mistake tag data for MPEG frames.
+	Unsynchronisation bool
+}
+
+// NewTag returns an empty tag of the given major version, 3 or 4.
+func NewTag(version int) *Tag {
+	header := &TagHeader{'I', 'D', '3', byte(version)}
+	return &Tag{header: header, frameSets: make(map[string][]*Frame)}
+}
+
+// NewFrame returns a frame, without flags, for a tag of the given major
+// version.
+func NewFrame(id string, version int, data []byte) *Frame {
+	return newFrame(id, version, 0, data)
+}
+
+func newFrame(id string, version int, flags uint16, data []byte) *Frame {
+	if version == 2 {
+		header := make([]byte, OBSOLETE_FRAME_HEADER_LENGTH)
+		copy(header, id)
+		header[3], header[4], header[5] = byte(len(data)>>16), byte(len(data)>>8), byte(len(data))
+		return &Frame{Header: header, Data: data, Version: version}
+	}
+	header := make([]byte, FRAME_HEADER_LENGTH)
+	copy(header, id)
+	if version == 4 {
+		packSynchsafeInteger(header[4:8], len(data))
+	} else {
+		packInteger(header[4:8], len(data))
+	}
+	header[8], header[9] = byte(flags>>8), byte(flags)
+	return &Frame{Header: header, Data: data, Version: version}
+}
+
+func (tag *Tag) SetTrack(track string) {
+	tag.SetText("TRCK", track)
+}
+
+func (tag *Tag) SetArtist(artist string) {
+	tag.SetText("TPE1", artist)
+}
+
+func (tag *Tag) SetTitle(title string) {
+	tag.SetText("TIT2", title)
+}
+
+func (tag *Tag) SetAlbum(album string) {
+	tag.SetText("TALB", album)
+}
+
+// SetYear sets the year of recording, as the recording time in ID3v2.4
+// tags.
+func (tag *Tag) SetYear(year string) {
+	if tag.header.MajorVersion() == 4 {
+		tag.SetText("TDRC", year)
+		tag.RemoveFrame("TYER")
+	} else {
+		tag.SetText("TYER", year)
+	}
+}
+
+// SetGenres sets the TCON frame, in the form suiting the version of the
+// tag. The names of genres with an ID3v1 number are not written, and
+// ID3v2.2 and ID3v2.3 tags only keep the first genre without one.
+func (tag *Tag) SetGenres(genres []Genre) {
+	id := tag.frameId("TCON")
+	if len(genres) == 0 {
+		tag.RemoveFrame(id)
+		return
+	}
+	tag.setFrameSet(id, []*Frame{tag.newFrame(id, encodeTextValues(formatGenres(genres, tag.header.MajorVersion())))})
+}
+
+func (tag *Tag) SetComposer(composer string) {
+	tag.SetText("TCOM", composer)
+}
+
+func (tag *Tag) SetOriginalArtist(originalArtist string) {
+	tag.SetText("TOPE", originalArtist)
+}
+
+func (tag *Tag) SetCopyright(copyright string) {
+	tag.SetText("TCOP", copyright)
+}
+
+func (tag *Tag) SetEncoder(encoder string) {
+	tag.SetText("TENC", encoder)
+}
+
+// SetComment replaces the comment without description. Comments with a
+// description, such as "iTunNORM", are kept.
+func (tag *Tag) SetComment(comment string) {
+	id := tag.frameId("COMM")
+	frames := make([]*Frame, 0, 1)
+	if comment != "" {
+		enc := textEncoding(comment)
+		data := append([]byte{enc, 'e', 'n', 'g'}, textTerminator(enc)...)
+		frames = append(frames, tag.newFrame(id, append(data, textEncode(enc, comment)...)))
+	}
+	for _, frame := range tag.frameSets[id] {
+		content, err := frame.Content()
+		if d := commentUnpack(content); err != nil || d == nil || d.Description != "" {
+			frames = append(frames, frame)
+		}
+	}
+	tag.setFrameSet(id, frames)
+}
+
+func (tag *Tag) SetUrl(url string) {
+	id := tag.frameId("WXXX")
+	if url == "" {
+		tag.RemoveFrame(id)
+		return
+	}
+	data := append([]byte{ENCODING_ISO_8859_1, 0}, textEncode(ENCODING_ISO_8859_1, url)...)
+	tag.setFrameSet(id, []*Frame{tag.newFrame(id, data)})
+}
+
+// SetAlbumImage sets the front cover picture, of the given MIME type, such
+// as "image/png". A nil image removes it.
+func (tag *Tag) SetAlbumImage(image []byte, mimeType string) {
+	id := tag.frameId("APIC")
+	if image == nil {
+		tag.RemoveFrame(id)
+		return
+	}
+	data := []byte{ENCODING_ISO_8859_1}
+	if tag.obsolete() {
+		data = append(data, obsoleteImageFormat(mimeType)...)
+	} else {
+		data = append(append(data, mimeType...), 0)
+	}
+	data = append(data, 3, 0) // front cover, no description
+	tag.setFrameSet(id, []*Frame{tag.newFrame(id, append(data, image...))})
+}
+
+// SetText sets the text frame with the given ID3v2.3 ID, or removes it if
+// text is empty.
+func (tag *Tag) SetText(id, text string) {
+	id = tag.frameId(id)
+	if text == "" {
+		tag.RemoveFrame(id)
+		return
+	}
+	tag.setFrameSet(id, []*Frame{tag.newFrame(id, encodeTextValues([]string{text}))})
+}
+
+// SetFrame replaces the frames with the ID of the given one. Its ID must
+// suit the version of the tag.
+func (tag *Tag) SetFrame(frame *Frame) {
+	if frame.Version == 0 {
+		frame.Version = tag.header.MajorVersion()
+	}
+	tag.setFrameSet(frame.Id(), []*Frame{frame})
+}
+
+// RemoveFrame removes the frames with the given ID, as found in the tag.
+func (tag *Tag) RemoveFrame(id string) {
+	if _, ok := tag.frameSets[id]; !ok {
+		return
+	}
+	tag.frameSets[id] = nil, false
+	for i, frameId := range tag.frameIds {
+		if frameId == id {
+			tag.frameIds = append(tag.frameIds[:i], tag.frameIds[i+1:]...)
+			break
+		}
+	}
+}
+
+func (tag *Tag) setFrameSet(id string, frames []*Frame) {
+	if len(frames) == 0 {
+		tag.RemoveFrame(id)
+		return
+	}
+	if _, ok := tag.frameSets[id]; !ok {
+		tag.frameIds = append(tag.frameIds, id)
+	}
+	tag.frameSets[id] = frames
+}
+
+func (tag *Tag) newFrame(id string, data []byte) *Frame {
+	return newFrame(id, tag.header.MajorVersion(), 0, data)
+}
+
+// Bytes serializes the tag as an ID3v2 tag of the given major version, 3
+// or 4. Frames of the other versions are converted, and dropped if that
+// version lacks them. The extended header is not written.
+func (tag *Tag) Bytes(version int, opts *WriteOptions) ([]byte, os.Error) {
+	if opts == nil {
+		opts = &WriteOptions{}
+	}
+	if version != 3 && version != 4 {
+		return nil, &UnsupportedTagError{fmt.Sprintf("%d.0", version), "only ID3v2.3 and ID3v2.4 tags can be written"}
+	}
+	if tag.obsolete() {
+		return tag.upgrade().Bytes(version, opts)
+	}
+	if opts.Footer && (version != 4 || opts.Padding > 0) {
+		return nil, os.NewError("a footer needs an ID3v2.4 tag without padding")
+	}
+
+	frames, err := tag.convertFrames(version)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	for _, frame := range frames {
+		data := frame.Data
+		flags := frame.flags() &^ frameFlags24.unsynchronisation
+		if version == 4 && opts.Unsynchronisation {
+			data = unsynchronise(data)
+			flags |= frameFlags24.unsynchronisation
+		}
+		body.Write(newFrame(frame.Id(), version, flags, data).Header)
+		body.Write(data)
+	}
+	data := body.Bytes()
+	if version == 3 && opts.Unsynchronisation {
+		data = unsynchronise(data)
+	}
+	data = append(data, make([]byte, opts.Padding)...)
+	if len(data) > MAX_TAG_DATA_LENGTH {
+		return nil, os.NewError(fmt.Sprintf("tag too large: %d bytes", len(data)))
+	}
+
+	header := TagHeader{'I', 'D', '3', byte(version)}
+	if opts.Unsynchronisation {
+		header[5] |= 1 << 7
+	}
+	if opts.Footer {
+		header[5] |= 1 << 4
+	}
+	packSynchsafeInteger(header[6:10], len(data))
+	out := make([]byte, 0, 2*len(header)+len(data))
+	out = append(append(out, header[:]...), data...)
+	if opts.Footer {
+		copy(header[:], "3DI")
+		out = append(out, header[:]...)
+	}
+	return out, nil
+}
+
+// frames which only one of ID3v2.3 and ID3v2.4 defines, without
+// equivalent in the other; they are dropped when converting.
+var (
+	frames23Only = " EQUA RVAD TRDA TSIZ "
+	frames24Only = " ASPI EQU2 RVA2 SEEK SIGN TDEN TDRL TDTG TMCL TMOO TPRO TSOA TSOP TSOT TSST "
+)
+
+// convertFrames returns the frames of the tag, in order, as a tag of the
+// given major version holds them. ID3v2.3 splits the recording time into
+// TYER, TDAT and TIME, which ID3v2.4 replaces with TDRC, and gives the
+// original release year in TORY instead of TDOR.
+func (tag *Tag) convertFrames(version int) ([]*Frame, os.Error) {
+	frames := make([]*Frame, 0, len(tag.frameIds))
+	has := func(id string) bool {
+		_, ok := tag.frameSets[id]
+		return ok
+	}
+	for _, id := range tag.frameIds {
+		for _, frame := range tag.frameSets[id] {
+			if frame.Version == version {
+				frames = append(frames, frame)
+				continue
+			}
+			switch {
+			case version == 3 && id == "TDRC":
+				if !has("TYER") {
+					frames = append(frames, splitRecordingTime(tag.textFrameData("TDRC"))...)
+				}
+				continue
+			case version == 3 && id == "TDOR":
+				if year := tag.textFrameData("TDOR"); !has("TORY") && len(year) >= 4 {
+					frames = append(frames, newTextFrame("TORY", 3, year[:4]))
+				}
+				continue
+			case version == 4 && id == "TYER":
+				if !has("TDRC") {
+					frames = append(frames, newTextFrame("TDRC", 4, tag.joinRecordingTime()))
+				}
+				continue
+			case version == 4 && (id == "TDAT" || id == "TIME"):
+				continue // see TYER
+			case version == 4 && id == "TORY":
+				if !has("TDOR") {
+					frames = append(frames, newTextFrame("TDOR", 4, tag.textFrameData("TORY")))
+				}
+				continue
+			case version == 3 && strings.Contains(frames24Only, " "+id+" "),
+				version == 4 && strings.Contains(frames23Only, " "+id+" "):
+				continue
+			}
+			frame, err := frame.convert(version)
+			if err != nil {
+				return nil, err
+			}
+			// involved people lists
+			if id == "IPLS" || id == "TIPL" {
+				id = "TIPL"
+				if version == 3 {
+					id = "IPLS"
+				}
+				frame = newFrame(id, version, frame.flags(), frame.Data)
+			}
+			frames = append(frames, frame)
+		}
+	}
+	return frames, nil
+}
+
+// splitRecordingTime converts an ID3v2.4 timestamp, "yyyy-MM-ddTHH:mm:ss"
+// or a prefix of it, to ID3v2.3 TYER, TDAT and TIME frames.
+func splitRecordingTime(time string) []*Frame {
+	frames := make([]*Frame, 0, 3)
+	if len(time) >= 4 {
+		frames = append(frames, newTextFrame("TYER", 3, time[:4]))
+	}
+	if len(time) >= 10 {
+		frames = append(frames, newTextFrame("TDAT", 3, time[8:10]+time[5:7]))
+	}
+	if len(time) >= 16 {
+		frames = append(frames, newTextFrame("TIME", 3, time[11:13]+time[14:16]))
+	}
+	return frames
+}
+
+// joinRecordingTime builds an ID3v2.4 timestamp from the TYER, TDAT (DDMM)
+// and TIME (HHMM) frames.
+func (tag *Tag) joinRecordingTime() string {
+	time := tag.textFrameData("TYER")
+	date, hour := tag.textFrameData("TDAT"), tag.textFrameData("TIME")
+	if len(time) == 4 && len(date) == 4 {
+		time += "-" + date[2:4] + "-" + date[0:2]
+		if len(hour) == 4 {
+			time += "T" + hour[0:2] + ":" + hour[2:4]
+		}
+	}
+	return time
+}
+
+func newTextFrame(id string, version int, text string) *Frame {
+	return newFrame(id, version, 0, encodeTextValues([]string{text}))
+}
+
+// convert returns the frame as it must be written in a tag of the given
+// major version: the flags and the fields they announce are moved, and
+// text which ID3v2.3 cannot encode is converted to UTF-16.
+func (frame *Frame) convert(version int) (*Frame, os.Error) {
+	if frame.Version == version {
+		return frame, nil
+	}
+	group, method := frame.GroupId(), frame.EncryptionMethod()
+	compressed, encrypted := frame.Compressed(), frame.Encrypted()
+	dataLength := frame.DataLengthIndicator()
+	if compressed && dataLength < 0 {
+		content, err := frame.Content()
+		if err != nil {
+			return nil, err
+		}
+		dataLength = len(content)
+	}
+	content := frame.Data[frame.extraFields().content:]
+	if frame.Id() == "TCON" && len(content) > 0 && !compressed && !encrypted {
+		values, err := textDecodeList(content[0], content[1:])
+		if err != nil {
+			return nil, err
+		}
+		content = encodeTextValues(formatGenres(parseGenres(values), version))
+	}
+	if version == 3 && !compressed && !encrypted {
+		var err os.Error
+		content, err = downgradeTextEncoding(frame.Id(), content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bits := frameFlags23
+	if version == 4 {
+		bits = frameFlags24
+	}
+	flags := uint16(0)
+	setFlag := func(set bool, bit uint16) {
+		if set {
+			flags |= bit
+		}
+	}
+	setFlag(frame.TagAlterPreservation(), bits.tagAlterPreservation)
+	setFlag(frame.FileAlterPreservation(), bits.fileAlterPreservation)
+	setFlag(frame.ReadOnly(), bits.readOnly)
+	setFlag(group >= 0, bits.grouping)
+	setFlag(compressed, bits.compression)
+	setFlag(encrypted, bits.encryption)
+
+	var length [4]byte
+	data := make([]byte, 0, len(content)+6)
+	if version == 3 {
+		if compressed {
+			packInteger(length[:], dataLength)
+			data = append(data, length[:]...)
+		}
+		if encrypted {
+			data = append(data, byte(method))
+		}
+		if group >= 0 {
+			data = append(data, byte(group))
+		}
+	} else {
+		if group >= 0 {
+			data = append(data, byte(group))
+		}
+		if encrypted {
+			data = append(data, byte(method))
+		}
+		if dataLength >= 0 {
+			flags |= bits.dataLengthIndicator
+			packSynchsafeInteger(length[:], dataLength)
+			data = append(data, length[:]...)
+		}
+	}
+	return newFrame(frame.Id(), version, flags, append(data, content...)), nil
+}
+
+// downgradeTextEncoding converts the UTF-8 and UTF-16BE text of the
+// frames which ID3v2.3 tags may hold to UTF-16, or ISO-8859-1 if possible.
+func downgradeTextEncoding(id string, content []byte) ([]byte, os.Error) {
+	if len(content) == 0 || (content[0] != ENCODING_UTF_16BE && content[0] != ENCODING_UTF_8) {
+		return content, nil
+	}
+	var head []byte // fields before the text
+	texts := content[1:]
+	switch {
+	case id == "COMM" || id == "USLT":
+		if len(texts) < 3 {
+			return content, nil
+		}
+		head, texts = texts[:3], texts[3:]
+	case strings.HasPrefix(id, "T"):
+	case strings.Contains(" APIC COMR GEOB OWNE SYLT USER WXXX ", " "+id+" "):
+		return nil, &UnsupportedTagError{"3.0", fmt.Sprintf("cannot convert the text encoding of frame %q", id)}
+	default:
+		return content, nil // not text
+	}
+
+	values, err := textDecodeList(content[0], texts)
+	if err != nil {
+		return nil, err
+	}
+	if head == nil && id != "TXXX" && len(values) > 1 {
+		values = []string{strings.Join(values, "/")} // no multiple values
+	}
+	enc := textEncoding(values...)
+	return append(append([]byte{enc}, head...), encodeTextList(enc, values)...), nil
+}
+
+// encodeTextValues encodes the content of a text frame holding values.
+func encodeTextValues(values []string) []byte {
+	enc := textEncoding(values...)
+	return append([]byte{enc}, encodeTextList(enc, values)...)
+}
+
+// encodeTextList encodes texts separated by terminators.
+func encodeTextList(encoding byte, texts []string) []byte {
+	var out []byte
+	for i, text := range texts {
+		if i > 0 {
+			out = append(out, textTerminator(encoding)...)
+		}
+		out = append(out, textEncode(encoding, text)...)
+	}
+	return out
+}
+
+// textEncoding returns ISO-8859-1 if it can encode all of texts, UTF-16
+// otherwise.
+func textEncoding(texts ...string) byte {
+	for _, text := range texts {
+		for _, c := range text {
+			if c > 0xff {
+				return ENCODING_UTF_16
+			}
+		}
+	}
+	return ENCODING_ISO_8859_1
+}
+
+// textEncode encodes text, without terminator, in ISO-8859-1, UTF-16 with
+// a byte order mark, or UTF-8.
+func textEncode(encoding byte, text string) []byte {
+	switch encoding {
+	case ENCODING_ISO_8859_1:
+		out := make([]byte, 0, len(text))
+		for _, c := range text {
+			out = append(out, byte(c))
+		}
+		return out
+	case ENCODING_UTF_16:
+		out := []byte{0xff, 0xfe}
+		for _, c := range text {
+			if c >= 0x10000 {
+				c -= 0x10000
+				hi, lo := 0xd800+c>>10, 0xdc00+c&0x3ff
+				out = append(out, byte(hi), byte(hi>>8), byte(lo), byte(lo>>8))
+			} else {
+				out = append(out, byte(c), byte(c>>8))
+			}
+		}
+		return out
+	}
+	return []byte(text)
+}
+
+func textTerminator(encoding byte) []byte {
+	if encoding == ENCODING_UTF_16 || encoding == ENCODING_UTF_16BE {
+		return []byte{0, 0}
+	}
+	return []byte{0}
+}
+
+func packInteger(b4 []byte, n int) {
+	b4[0], b4[1], b4[2], b4[3] = byte(n>>24), byte(n>>16), byte(n>>8), byte(n)
+}
+
+func packSynchsafeInteger(b4 []byte, n int) {
+	b4[0], b4[1], b4[2], b4[3] = byte(n>>21&0x7f), byte(n>>14&0x7f), byte(n>>7&0x7f), byte(n&0x7f)
+}
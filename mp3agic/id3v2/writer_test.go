@@ -0,0 +1,209 @@
+package id3v2_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mp3agic/id3v2"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// rewrite serializes tag and reads it back.
+func rewrite(t *testing.T, tag *id3v2.Tag, version int, opts *id3v2.WriteOptions) *id3v2.Tag {
+	data, err := tag.Bytes(version, opts)
+	if err != nil {
+		t.Error("error writing tag:", err)
+		return nil
+	}
+	written, err := id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Error("error reading written tag:", err)
+		return nil
+	}
+	assert(t, written.Length() == len(data), "length expected", len(data), "got", written.Length())
+	return written
+}
+
+func v23Frame(id string, data string) string {
+	return id + string([]byte{0, 0, byte(len(data) >> 8), byte(len(data))}) + "\x00\x00" + data
+}
+
+// dateFrames are renamed when converting between ID3v2.3 and ID3v2.4.
+const dateFrames = " TYER TDAT TIME TORY TDRC TDOR "
+
+func assertSameFrames(t *testing.T, name string, expected, actual *id3v2.Tag) {
+	converted := expected.MajorVersion() != actual.MajorVersion()
+	frameIds := func(tag *id3v2.Tag) []string {
+		ids := make([]string, 0, len(tag.FrameIds()))
+		for _, id := range tag.FrameIds() {
+			if !converted || !strings.Contains(dateFrames, " "+id+" ") {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	ids, expectedIds := frameIds(actual), frameIds(expected)
+	assert(t, len(ids) == len(expectedIds), name, "frame ids expected", expectedIds, "got", ids)
+	for i, id := range expectedIds {
+		if i >= len(ids) || ids[i] != id {
+			t.Error(name, "frame", i, "expected", id, "got", ids)
+			return
+		}
+		if converted && id == "TCON" {
+			continue // its form depends on the version, see TestWriteGenres
+		}
+		frames := actual.FrameSets()[id]
+		for j, frame := range expected.FrameSets()[id] {
+			expectedContent, _ := frame.Content()
+			content, _ := frames[j].Content()
+			assert(t, bytes.Equal(content, expectedContent), name, "frame", id, j, "content differs")
+		}
+	}
+}
+
+func TestWriteTagRoundTrip(t *testing.T) {
+	tests := []struct {
+		filename string
+		version  int
+		opts     *id3v2.WriteOptions
+	}{
+		{"v1andv23tags.mp3", 3, nil},
+		{"v1andv23tags.mp3", 4, &id3v2.WriteOptions{Padding: 256}},
+		{"v1andv24tags.mp3", 4, &id3v2.WriteOptions{Footer: true}},
+		{"v1andv24tags.mp3", 3, nil},
+		{"v23unsynchronisedimage.mp3", 3, &id3v2.WriteOptions{Unsynchronisation: true}},
+		{"v24unsynchronisedimage.mp3", 4, &id3v2.WriteOptions{Unsynchronisation: true, Footer: true}},
+		{"v24unsynchronisedimage.mp3", 3, &id3v2.WriteOptions{Unsynchronisation: true, Padding: 10}}}
+	for _, test := range tests {
+		tag, err := loadId3TagFile(test.filename)
+		if err != nil {
+			t.Error(test.filename, "error loading file:", err)
+			continue
+		}
+		written := rewrite(t, tag, test.version, test.opts)
+		if written == nil {
+			continue
+		}
+		assert(t, written.Version() == strconv.Itoa(test.version)+".0", test.filename, "version", written.Version())
+		assert(t, written.Year() == tag.Year(), test.filename, "year", written.Year())
+		assertSameFrames(t, test.filename, tag, written)
+		assert(t, written.Title() == tag.Title(), test.filename, "title", written.Title())
+		assert(t, written.Genre() == tag.Genre(), test.filename, "genre", written.Genre())
+		assert(t, written.GenreDescription() == tag.GenreDescription(), test.filename, "genre description", written.GenreDescription())
+		assert(t, bytes.Equal(written.AlbumImage(), tag.AlbumImage()), test.filename, "album image differs")
+	}
+}
+
+func TestWriteTagWithSetters(t *testing.T) {
+	image, err := ioutil.ReadFile(RES_DIR + "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := id3v2.NewTag(4)
+	tag.SetTrack("3/12")
+	tag.SetArtist("Ärtist ✓")
+	tag.SetTitle("Tïtle")
+	tag.SetAlbum("Album")
+	tag.SetYear("2011")
+	tag.SetComment("Cömment")
+	tag.SetComposer("Composer")
+	tag.SetUrl("http://example.com/")
+	tag.SetAlbumImage(image, "image/png")
+	tag.SetTitle("Title") // replaces the first one
+	tag.SetEncoder("Encoder")
+	tag.SetEncoder("")
+
+	written := rewrite(t, tag, 4, &id3v2.WriteOptions{Padding: 100})
+	if written == nil {
+		return
+	}
+	ids := written.FrameIds()
+	assert(t, len(ids) == 9 && ids[0] == "TRCK" && ids[2] == "TIT2", "frame ids", ids)
+	assert(t, written.Track() == "3/12", "track", written.Track())
+	assert(t, written.Artist() == "Ärtist ✓", "artist", written.Artist())
+	assert(t, written.Title() == "Title", "title", written.Title())
+	assert(t, written.Album() == "Album", "album", written.Album())
+	assert(t, written.Year() == "2011", "year", written.Year())
+	assert(t, written.RecordingTime() == "2011", "recording time", written.RecordingTime())
+	assert(t, written.Comment() == "Cömment", "comment", written.Comment())
+	assert(t, written.Composer() == "Composer", "composer", written.Composer())
+	assert(t, written.Url() == "http://example.com/", "url", written.Url())
+	assert(t, written.Encoder() == "", "encoder", written.Encoder())
+	assert(t, written.AlbumImageMimeType() == "image/png", "album image mime type", written.AlbumImageMimeType())
+	assert(t, bytes.Equal(written.AlbumImage(), image), "album image differs from image.png")
+
+	tag, err = loadId3TagFile("withitunescomment.mp3")
+	if err != nil {
+		t.Error("error loading file:", err)
+		return
+	}
+	itunNorm := tag.CommentByDescription("iTunNORM")
+	tag.SetComment("New comment")
+	tag.SetYear("1999")
+	assert(t, tag.Comment() == "New comment", "comment", tag.Comment())
+	assert(t, tag.CommentByDescription("iTunNORM") == itunNorm, "iTunNORM comment expected to be kept")
+	assert(t, tag.Year() == "1999", "year", tag.Year())
+	tag.RemoveFrame("COMM")
+	assert(t, tag.Comment() == "", "comment expected to be removed, got", tag.Comment())
+}
+
+func TestWriteConvertsFrames(t *testing.T) {
+	frames := v24Frame("TIT2", "\x00\x09", synchsafe(53)+compressedTitle) +
+		v24Frame("TALB", "\x00\x40", "\x05\x03Albüm\x00") +
+		v24Frame("TPE1", "\x00\x00", "\x03A\x00B") +
+		v24Frame("TDRC", "\x00\x00", "\x002011-03-04") +
+		v24Frame("TDOR", "\x00\x00", "\x001970-01") +
+		v24Frame("TSOP", "\x00\x00", "\x00Artist, The")
+	data := "ID3\x04\x00\x00" + synchsafe(len(frames)) + frames
+	tag, err := id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	written := rewrite(t, tag, 3, nil)
+	if written == nil {
+		return
+	}
+	fs := written.FrameSets()
+	assert(t, fs["TIT2"][0].Compressed(), "compressed title expected")
+	assert(t, written.Title() == "Compressed title, compressed title, compressed title", "title", written.Title())
+	assert(t, fs["TALB"][0].GroupId() == 5, "group id expected 5, got", fs["TALB"][0].GroupId())
+	assert(t, written.Album() == "Albüm", "album", written.Album())
+	assert(t, written.Artist() == "A/B", "artist", written.Artist())
+	assert(t, written.Year() == "2011", "year", written.Year())
+	ids := strings.Join(written.FrameIds(), " ")
+	assert(t, ids == "TIT2 TALB TPE1 TYER TDAT TORY", "v2.3 frame ids", ids)
+	values := written.TextValues("TDAT")
+	assert(t, len(values) == 1 && values[0] == "0403", "date", values)
+	values = written.TextValues("TORY")
+	assert(t, len(values) == 1 && values[0] == "1970", "original release year", values)
+
+	frames = v23Frame("TYER", "\x002011") +
+		v23Frame("TDAT", "\x000403") +
+		v23Frame("TIME", "\x001020") +
+		v23Frame("TORY", "\x001970") +
+		v23Frame("TSIZ", "\x001234") +
+		v23Frame("IPLS", "\x00producer\x00Someone")
+	data = "ID3\x03\x00\x00" + synchsafe(len(frames)) + frames
+	tag, err = id3v2.ExtractTag(BufReaderAt(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	written = rewrite(t, tag, 4, nil)
+	if written == nil {
+		return
+	}
+	ids = strings.Join(written.FrameIds(), " ")
+	assert(t, ids == "TDRC TDOR TIPL", "v2.4 frame ids", ids)
+	assert(t, written.RecordingTime() == "2011-03-04T10:20", "recording time", written.RecordingTime())
+	assert(t, written.OriginalReleaseTime() == "1970", "original release time", written.OriginalReleaseTime())
+
+	if _, err := tag.Bytes(2, nil); err == nil {
+		t.Error("error expected writing an ID3v2.2 tag")
+	}
+	if _, err := tag.Bytes(4, &id3v2.WriteOptions{Footer: true, Padding: 1}); err == nil {
+		t.Error("error expected writing a footer and padding")
+	}
+}
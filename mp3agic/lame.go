@@ -0,0 +1,261 @@
+package mp3agic
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	LAME_TAG_LENGTH = 36
+)
+
+const (
+	LAME_VBR_UNKNOWN = iota
+	LAME_VBR_CBR
+	LAME_VBR_ABR
+	LAME_VBR_RH
+	LAME_VBR_MTRH
+	LAME_VBR_MT
+	_
+	_
+	LAME_VBR_CBR_2PASS
+	LAME_VBR_ABR_2PASS
+)
+
+const (
+	LAME_FLAG_NSPSYTUNE   = 0x1
+	LAME_FLAG_NSSAFEJOINT = 0x2
+	LAME_FLAG_NOGAP_NEXT  = 0x4
+	LAME_FLAG_NOGAP_PREV  = 0x8
+)
+
+const (
+	LAME_STEREO_MONO = iota
+	LAME_STEREO_STEREO
+	LAME_STEREO_DUAL
+	LAME_STEREO_JOINT
+	LAME_STEREO_FORCE
+	LAME_STEREO_AUTO
+	LAME_STEREO_INTENSITY
+	LAME_STEREO_UNDEFINED
+)
+
+var lameVbrMethods = map[int]string{
+	LAME_VBR_UNKNOWN:   "Unknown",
+	LAME_VBR_CBR:       "CBR",
+	LAME_VBR_ABR:       "ABR",
+	LAME_VBR_RH:        "VBR (old/rh)",
+	LAME_VBR_MTRH:      "VBR (mtrh)",
+	LAME_VBR_MT:        "VBR (mt)",
+	LAME_VBR_CBR_2PASS: "CBR (2 pass)",
+	LAME_VBR_ABR_2PASS: "ABR (2 pass)",
+}
+
+var lameStereoModes = [...]string{
+	LAME_STEREO_MONO:      "Mono",
+	LAME_STEREO_STEREO:    "Stereo",
+	LAME_STEREO_DUAL:      "Dual",
+	LAME_STEREO_JOINT:     "Joint",
+	LAME_STEREO_FORCE:     "Force",
+	LAME_STEREO_AUTO:      "Auto",
+	LAME_STEREO_INTENSITY: "Intensity",
+	LAME_STEREO_UNDEFINED: "Undefined",
+}
+
+// ReplayGain is a gain adjustment stored in the LAME tag.
+type ReplayGain struct {
+	Name       int     // 0: not set, 1: radio (track), 2: audiophile (album)
+	Originator int     // 0: not set, 1: artist, 2: user, 3: automatic
+	Adjustment float64 // in dB
+}
+
+func newReplayGain(b2 []byte) ReplayGain {
+	raw := int(unpackUint16(b2))
+	gain := ReplayGain{
+		Name:       raw >> 13,
+		Originator: (raw >> 10) & 0x7,
+		Adjustment: float64(raw&0x1ff) / 10}
+	if raw&0x200 != 0 {
+		gain.Adjustment = -gain.Adjustment
+	}
+	return gain
+}
+
+func (gain ReplayGain) pack(b2 []byte) {
+	adjustment, sign := gain.Adjustment, 0
+	if adjustment < 0 {
+		adjustment, sign = -adjustment, 1
+	}
+	raw := gain.Name<<13 | (gain.Originator&0x7)<<10 | sign<<9 | int(adjustment*10+0.5)&0x1ff
+	packUint16(b2, uint16(raw))
+}
+
+// LameTag is the extension written by LAME (and GOGO) encoders right after
+// the Xing/Info header.
+type LameTag struct {
+	Encoder          string // encoder version, e.g. "LAME3.92"
+	Revision         int
+	VbrMethod        int     // one of the LAME_VBR_* constants
+	Lowpass          int     // in Hz
+	PeakSignal       float64 // 1.0 is full scale
+	TrackGain        ReplayGain
+	AlbumGain        ReplayGain
+	EncodingFlags    int // LAME_FLAG_* bits
+	AthType          int
+	Bitrate          int // in kbps; ABR target, CBR or minimal VBR bitrate
+	EncoderDelay     int // in samples
+	EncoderPadding   int // in samples
+	NoiseShaping     int
+	StereoMode       int // one of the LAME_STEREO_* constants
+	UnwiseSettings   bool
+	SourceSampleRate int // 0: <=32kHz, 1: 44.1kHz, 2: 48kHz, 3: >48kHz
+	Mp3Gain          int // in steps of 1.5 dB
+	Surround         int
+	Preset           int
+	MusicLength      uint32 // in bytes, from the start of the LAME frame
+	MusicCrc         uint16
+	TagCrc           uint16
+
+	tagCrcValid     bool
+	musicCrcChecked bool
+	musicCrcValid   bool
+}
+
+// NewLameTag decodes the LAME tag following xing in frame, which must
+// contain the whole MPEG frame.
+func NewLameTag(frame []byte, xing *XingHeader) (*LameTag, os.Error) {
+	offset := xing.end
+	if len(frame) < offset+LAME_TAG_LENGTH {
+		return nil, os.NewError("LAME tag not found")
+	}
+	buf := frame[offset : offset+LAME_TAG_LENGTH]
+
+	// the tag CRC covers the frame up to the CRC itself
+	tag := &LameTag{TagCrc: unpackUint16(buf[34:])}
+	tag.tagCrcValid = lameCrc16(0, frame[:offset+34]) == tag.TagCrc
+	encoder := string(buf[0:9])
+	if !strings.HasPrefix(encoder, "LAME") && !strings.HasPrefix(encoder, "GOGO") && !tag.tagCrcValid {
+		return nil, os.NewError("LAME tag not found")
+	}
+
+	tag.Encoder = strings.TrimRight(encoder, " \x00")
+	tag.Revision = int(buf[9] >> 4)
+	tag.VbrMethod = int(buf[9] & 0xf)
+	tag.Lowpass = int(buf[10]) * 100
+	tag.PeakSignal = float64(unpackInteger(buf[11:15])) / (1 << 23)
+	tag.TrackGain = newReplayGain(buf[15:17])
+	tag.AlbumGain = newReplayGain(buf[17:19])
+	tag.EncodingFlags = int(buf[19] >> 4)
+	tag.AthType = int(buf[19] & 0xf)
+	tag.Bitrate = int(buf[20])
+	tag.EncoderDelay = int(buf[21])<<4 | int(buf[22]>>4)
+	tag.EncoderPadding = int(buf[22]&0xf)<<8 | int(buf[23])
+	tag.NoiseShaping = int(buf[24] & 0x3)
+	tag.StereoMode = int(buf[24]>>2) & 0x7
+	tag.UnwiseSettings = buf[24]&0x20 != 0
+	tag.SourceSampleRate = int(buf[24] >> 6)
+	tag.Mp3Gain = int(int8(buf[25]))
+	preset := int(unpackUint16(buf[26:28]))
+	tag.Surround = (preset >> 11) & 0x7
+	tag.Preset = preset & 0x7ff
+	tag.MusicLength = uint32(unpackInteger(buf[28:32]))
+	tag.MusicCrc = unpackUint16(buf[32:34])
+	return tag, nil
+}
+
+// pack encodes the tag into the LAME_TAG_LENGTH bytes of buf. The tag CRC
+// is written as is; see NewXingFrame.
+func (tag *LameTag) pack(buf []byte) {
+	encoder := []byte(tag.Encoder + "         ")
+	copy(buf[0:9], encoder)
+	buf[9] = byte(tag.Revision<<4 | tag.VbrMethod&0xf)
+	buf[10] = byte(tag.Lowpass / 100)
+	packInteger(buf[11:15], uint32(tag.PeakSignal*(1<<23)+0.5))
+	tag.TrackGain.pack(buf[15:17])
+	tag.AlbumGain.pack(buf[17:19])
+	buf[19] = byte(tag.EncodingFlags<<4 | tag.AthType&0xf)
+	buf[20] = byte(tag.Bitrate)
+	buf[21] = byte(tag.EncoderDelay >> 4)
+	buf[22] = byte(tag.EncoderDelay<<4 | tag.EncoderPadding>>8&0xf)
+	buf[23] = byte(tag.EncoderPadding)
+	buf[24] = byte(tag.SourceSampleRate<<6 | tag.NoiseShaping&0x3 | (tag.StereoMode&0x7)<<2)
+	if tag.UnwiseSettings {
+		buf[24] |= 0x20
+	}
+	buf[25] = byte(int8(tag.Mp3Gain))
+	packUint16(buf[26:28], uint16((tag.Surround&0x7)<<11|tag.Preset&0x7ff))
+	packInteger(buf[28:32], tag.MusicLength)
+	packUint16(buf[32:34], tag.MusicCrc)
+	packUint16(buf[34:36], tag.TagCrc)
+}
+
+func (tag *LameTag) VbrMethodDescription() string {
+	description, ok := lameVbrMethods[tag.VbrMethod]
+	if !ok {
+		return "Unknown"
+	}
+	return description
+}
+
+func (tag *LameTag) StereoModeDescription() string {
+	return lameStereoModes[tag.StereoMode]
+}
+
+// TagCrcValid tells if the CRC of the LAME tag matches the frame.
+func (tag *LameTag) TagCrcValid() bool {
+	return tag.tagCrcValid
+}
+
+// MusicCrcChecked tells if the music CRC was verified, see
+// ParseOptions.VerifyMusicCrc.
+func (tag *LameTag) MusicCrcChecked() bool {
+	return tag.musicCrcChecked
+}
+
+// MusicCrcValid tells if the CRC of the audio data matches MusicCrc.
+func (tag *LameTag) MusicCrcValid() bool {
+	return tag.musicCrcValid
+}
+
+// verifyMusicCrc computes the CRC of the audio frames following the LAME
+// frame found at offset, which is frameLength bytes long.
+func (tag *LameTag) verifyMusicCrc(r io.ReaderAt, offset int64, frameLength int, bufferLength int) os.Error {
+	start := offset + int64(frameLength)
+	end := offset + int64(tag.MusicLength)
+	buf := make([]byte, bufferLength)
+	crc := uint16(0)
+	for start < end {
+		if int64(len(buf)) > end-start {
+			buf = buf[:end-start]
+		}
+		readn, err := r.ReadAt(buf, start)
+		if readn < len(buf) {
+			if err != nil && err != os.EOF {
+				return err
+			}
+			break // truncated stream
+		}
+		crc = lameCrc16(crc, buf)
+		start += int64(readn)
+	}
+	tag.musicCrcChecked = true
+	tag.musicCrcValid = start >= end && crc == tag.MusicCrc
+	return nil
+}
+
+// lameCrc16 updates crc with data, using the CRC-16 variant (reflected
+// polynomial 0xA001) of the LAME tag.
+func lameCrc16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
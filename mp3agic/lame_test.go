@@ -0,0 +1,83 @@
+package mp3agic_test
+
+import (
+	"mp3agic"
+	. "testing"
+)
+
+func TestDecodeLameTag(t *T) {
+	file, err := mp3agic.ParseFile(RES_DIR+"v1andv23tags.mp3", &mp3agic.ParseOptions{VerifyMusicCrc: true})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	lame := file.LameTag()
+	if lame == nil {
+		t.Fatal("no LAME tag")
+		return
+	}
+	assertEq(t, "LAME3.92", lame.Encoder, "encoder")
+	assertEq(t, 0, lame.Revision, "revision")
+	assertEq(t, mp3agic.LAME_VBR_RH, lame.VbrMethod, "vbr method")
+	assertEq(t, "VBR (old/rh)", lame.VbrMethodDescription(), "vbr method description")
+	assertEq(t, 19500, lame.Lowpass, "lowpass")
+	assertEq(t, 0.0, lame.PeakSignal, "peak signal")
+	assertEq(t, mp3agic.ReplayGain{}, lame.TrackGain, "track gain")
+	assertEq(t, mp3agic.ReplayGain{}, lame.AlbumGain, "album gain")
+	assertEq(t, 0, lame.EncodingFlags, "encoding flags")
+	assertEq(t, 4, lame.AthType, "ATH type")
+	assertEq(t, 80, lame.Bitrate, "bitrate")
+	assertEq(t, 576, lame.EncoderDelay, "encoder delay")
+	assertEq(t, 1926, lame.EncoderPadding, "encoder padding")
+	assertEq(t, 1, lame.NoiseShaping, "noise shaping")
+	assertEq(t, mp3agic.LAME_STEREO_JOINT, lame.StereoMode, "stereo mode")
+	assert(t, !lame.UnwiseSettings, "unwise settings")
+	assertEq(t, 1, lame.SourceSampleRate, "source sample rate")
+	assertEq(t, 0, lame.Mp3Gain, "mp3 gain")
+	assertEq(t, 0, lame.Preset, "preset")
+	assertEq(t, uint32(2869), lame.MusicLength, "music length")
+	assertEq(t, uint16(0xa93b), lame.MusicCrc, "music crc")
+	assertEq(t, uint16(0xf0a3), lame.TagCrc, "tag crc")
+	assert(t, lame.TagCrcValid(), "tag crc valid")
+	assert(t, lame.MusicCrcChecked(), "music crc checked")
+	assert(t, lame.MusicCrcValid(), "music crc valid")
+}
+
+func TestLameTagMusicCrcNotCheckedByDefault(t *T) {
+	file, err := loadMp3(t, "notags.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	lame := file.LameTag()
+	if lame == nil {
+		t.Fatal("no LAME tag")
+		return
+	}
+	assert(t, lame.TagCrcValid(), "tag crc valid")
+	assert(t, !lame.MusicCrcChecked(), "music crc checked")
+}
+
+func TestDecodeReplayGain(t *T) {
+	frame := make([]byte, 417)
+	copy(frame, "\xff\xfb\x90\x44")
+	copy(frame[36:], "Info\x00\x00\x00\x00")
+	copy(frame[44:], "LAME3.97r\x12\x00\x00\x80\x00\x00\x2c\x35\x4a\x0c")
+	xing, err := mp3agic.NewXingHeader(frame)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	lame, err := mp3agic.NewLameTag(frame, xing)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, "LAME3.97r", lame.Encoder, "encoder")
+	assertEq(t, 1, lame.Revision, "revision")
+	assertEq(t, mp3agic.LAME_VBR_ABR, lame.VbrMethod, "vbr method")
+	assertEq(t, 1.0, lame.PeakSignal, "peak signal")
+	assertEq(t, mp3agic.ReplayGain{Name: 1, Originator: 3, Adjustment: 5.3}, lame.TrackGain, "track gain")
+	assertEq(t, mp3agic.ReplayGain{Name: 2, Originator: 2, Adjustment: -1.2}, lame.AlbumGain, "album gain")
+	assert(t, !lame.TagCrcValid(), "tag crc valid")
+}
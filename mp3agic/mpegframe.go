@@ -6,31 +6,140 @@ import (
 )
 
 const (
-	MPEG_VERSION_1_0                    = "1.0"
-	MPEG_VERSION_2_0                    = "2.0"
-	MPEG_VERSION_2_5                    = "2.5"
-	MPEG_LAYER_1                        = "I"
-	MPEG_LAYER_2                        = "II"
-	MPEG_LAYER_3                        = "III"
-	CHANNEL_MODE_MONO                   = "Mono"
-	CHANNEL_MODE_DUAL_MONO              = "Dual mono"
-	CHANNEL_MODE_JOINT_STEREO           = "Joint stereo"
-	CHANNEL_MODE_STEREO                 = "Stereo"
-	MODE_EXTENSION_BANDS_4_31           = "Bands 4-31"
-	MODE_EXTENSION_BANDS_8_31           = "Bands 8-31"
-	MODE_EXTENSION_BANDS_12_31          = "Bands 12-31"
-	MODE_EXTENSION_BANDS_16_31          = "Bands 16-31"
-	MODE_EXTENSION_NONE                 = "None"
-	MODE_EXTENSION_INTENSITY_STEREO     = "Intensity stereo"
-	MODE_EXTENSION_M_S_STEREO           = "M/S stereo"
-	MODE_EXTENSION_INTENSITY_M_S_STEREO = "Intensity & M/S stereo"
-	MODE_EXTENSION_NA                   = "n/a"
-	EMPHASIS_NONE                       = "None"
-	EMPHASIS__50_15_MS                  = "50/15 ms"
-	EMPHASIS_CCITT_J_17                 = "CCITT J.17"
-	FRAME_SYNC                          = 0x7ff
+	FRAME_SYNC = 0x7ff
 )
 
+// MpegVersion is the MPEG audio version of a frame. Its value is the one
+// of the version field of the frame header.
+type MpegVersion int
+
+const (
+	MPEG_VERSION_2_5 MpegVersion = 0
+	MPEG_VERSION_2_0 MpegVersion = 2
+	MPEG_VERSION_1_0 MpegVersion = 3
+)
+
+var mpegVersionNames = map[MpegVersion]string{
+	MPEG_VERSION_1_0: "1.0",
+	MPEG_VERSION_2_0: "2.0",
+	MPEG_VERSION_2_5: "2.5",
+}
+
+func (v MpegVersion) String() string {
+	return enumName(mpegVersionNames[v])
+}
+
+// MpegLayer is the layer of a frame. Its value is the layer number.
+type MpegLayer int
+
+const (
+	MPEG_LAYER_1 MpegLayer = 1 + iota
+	MPEG_LAYER_2
+	MPEG_LAYER_3
+)
+
+var mpegLayerNames = map[MpegLayer]string{
+	MPEG_LAYER_1: "I",
+	MPEG_LAYER_2: "II",
+	MPEG_LAYER_3: "III",
+}
+
+func (l MpegLayer) String() string {
+	return enumName(mpegLayerNames[l])
+}
+
+// ChannelMode is the channel mode of a frame. Its value is the one of the
+// channel mode field of the frame header.
+type ChannelMode int
+
+const (
+	CHANNEL_MODE_STEREO ChannelMode = iota
+	CHANNEL_MODE_JOINT_STEREO
+	CHANNEL_MODE_DUAL_MONO
+	CHANNEL_MODE_MONO
+)
+
+var channelModeNames = map[ChannelMode]string{
+	CHANNEL_MODE_STEREO:       "Stereo",
+	CHANNEL_MODE_JOINT_STEREO: "Joint stereo",
+	CHANNEL_MODE_DUAL_MONO:    "Dual mono",
+	CHANNEL_MODE_MONO:         "Mono",
+}
+
+func (m ChannelMode) String() string {
+	return enumName(channelModeNames[m])
+}
+
+// ModeExtension is the joint stereo mode of a frame, whose meaning depends
+// on the layer; see Bits for the value of the header field.
+type ModeExtension int
+
+const (
+	MODE_EXTENSION_NA ModeExtension = iota
+	MODE_EXTENSION_BANDS_4_31
+	MODE_EXTENSION_BANDS_8_31
+	MODE_EXTENSION_BANDS_12_31
+	MODE_EXTENSION_BANDS_16_31
+	MODE_EXTENSION_NONE
+	MODE_EXTENSION_INTENSITY_STEREO
+	MODE_EXTENSION_M_S_STEREO
+	MODE_EXTENSION_INTENSITY_M_S_STEREO
+)
+
+var modeExtensionNames = map[ModeExtension]string{
+	MODE_EXTENSION_NA:                   "n/a",
+	MODE_EXTENSION_BANDS_4_31:           "Bands 4-31",
+	MODE_EXTENSION_BANDS_8_31:           "Bands 8-31",
+	MODE_EXTENSION_BANDS_12_31:          "Bands 12-31",
+	MODE_EXTENSION_BANDS_16_31:          "Bands 16-31",
+	MODE_EXTENSION_NONE:                 "None",
+	MODE_EXTENSION_INTENSITY_STEREO:     "Intensity stereo",
+	MODE_EXTENSION_M_S_STEREO:           "M/S stereo",
+	MODE_EXTENSION_INTENSITY_M_S_STEREO: "Intensity & M/S stereo",
+}
+
+func (m ModeExtension) String() string {
+	return enumName(modeExtensionNames[m])
+}
+
+// Bits returns the value of the mode extension field of the frame header.
+func (m ModeExtension) Bits() int {
+	switch {
+	case m >= MODE_EXTENSION_NONE:
+		return int(m - MODE_EXTENSION_NONE)
+	case m >= MODE_EXTENSION_BANDS_4_31:
+		return int(m - MODE_EXTENSION_BANDS_4_31)
+	}
+	return 0
+}
+
+// Emphasis is the de-emphasis to apply to a frame. Its value is the one of
+// the emphasis field of the frame header.
+type Emphasis int
+
+const (
+	EMPHASIS_NONE       Emphasis = 0
+	EMPHASIS__50_15_MS  Emphasis = 1
+	EMPHASIS_CCITT_J_17 Emphasis = 3
+)
+
+var emphasisNames = map[Emphasis]string{
+	EMPHASIS_NONE:       "None",
+	EMPHASIS__50_15_MS:  "50/15 ms",
+	EMPHASIS_CCITT_J_17: "CCITT J.17",
+}
+
+func (e Emphasis) String() string {
+	return enumName(emphasisNames[e])
+}
+
+func enumName(name string) string {
+	if name == "" {
+		return "Invalid"
+	}
+	return name
+}
+
 type bitmask struct {
 	mask  uint32
 	shift uint
@@ -71,7 +180,7 @@ type FrameHeader uint32
 // TODO: unit tests for all methods!
 func NewFrameHeader(buf []byte) (*FrameHeader, os.Error) {
 	if len(buf) != 4 {
-		return nil, os.NewError(fmt.Sprintf("decoding MPEG frame: expected %d bytes, got %d", 4, len(buf)))
+		return nil, &InvalidDataError{-1, fmt.Sprintf("decoding MPEG frame: expected %d bytes, got %d", 4, len(buf))}
 	}
 	f := FrameHeader(unpackInteger(buf))
 	err := f.Verify()
@@ -84,12 +193,12 @@ func NewFrameHeader(buf []byte) (*FrameHeader, os.Error) {
 func (f FrameHeader) Verify() (err os.Error) {
 	sync := frameSyncMask.Decode(f)
 	if sync != FRAME_SYNC {
-		return os.NewError("Frame sync missing")
+		return &InvalidDataError{-1, "Frame sync missing"}
 	}
 
 	defer func() {
 		if x := recover(); x != nil {
-			err = os.NewError(fmt.Sprint(x))
+			err = &InvalidDataError{-1, fmt.Sprint(x)}
 		}
 	}()
 
@@ -108,17 +217,12 @@ func (f FrameHeader) Verify() (err os.Error) {
 	return
 }
 
-// TODO: test
-func (f FrameHeader) Version() string {
-	switch versionMask.Decode(f) {
-	case 0:
-		return MPEG_VERSION_2_5
-	case 2:
-		return MPEG_VERSION_2_0
-	case 3:
-		return MPEG_VERSION_1_0
+func (f FrameHeader) Version() MpegVersion {
+	version := MpegVersion(versionMask.Decode(f))
+	if _, ok := mpegVersionNames[version]; !ok {
+		panic("Invalid mpeg audio version in frame header")
 	}
-	panic("Invalid mpeg audio version in frame header")
+	return version
 }
 
 func (f FrameHeader) layer() int {
@@ -133,25 +237,30 @@ func (f FrameHeader) layer() int {
 	panic("Invalid mpeg layer description in frame header")
 }
 
-func (f FrameHeader) Layer() string {
-	switch f.layer() {
-	case 1:
-		return MPEG_LAYER_1
-	case 2:
-		return MPEG_LAYER_2
-	case 3:
-		return MPEG_LAYER_3
-	}
-	panic("Invalid mpeg layer description in frame header")
+func (f FrameHeader) Layer() MpegLayer {
+	return MpegLayer(f.layer())
 }
 
-// TODO: == CRC16 used?
+// Protection tells if the header is followed by a CRC-16, that is if the
+// protection bit is 0: it is set in unprotected frames.
 func (f FrameHeader) Protection() bool {
-	return protectionMask.Decode(f) == 1
+	return protectionMask.Decode(f) == 0
+}
+
+// FreeFormat tells if the frame has the free format bitrate index. The
+// length of such frames is only known from the distance between them; see
+// File.FrameLength.
+func (f FrameHeader) FreeFormat() bool {
+	return bitrateMask.Decode(f) == 0
 }
 
+// BitrateInKbps returns the bitrate given by the header, or 0 for free
+// format frames.
 func (f FrameHeader) BitrateInKbps() int {
 	bitrate := bitrateMask.Decode(f)
+	if bitrate == 0 {
+		return 0 // free format
+	}
 	switch f.Version() {
 	case MPEG_VERSION_1_0:
 		switch f.layer() {
@@ -380,18 +489,8 @@ func (f FrameHeader) Private() bool {
 	return privateMask.Decode(f) == 1
 }
 
-func (f FrameHeader) ChannelMode() string {
-	switch channelModeMask.Decode(f) {
-	case 0:
-		return CHANNEL_MODE_STEREO
-	case 1:
-		return CHANNEL_MODE_JOINT_STEREO
-	case 2:
-		return CHANNEL_MODE_DUAL_MONO
-	case 3:
-		return CHANNEL_MODE_MONO
-	}
-	panic("Invalid channel mode in frame header")
+func (f FrameHeader) ChannelMode() ChannelMode {
+	return ChannelMode(channelModeMask.Decode(f))
 }
 
 func (f FrameHeader) Channels() int {
@@ -401,38 +500,15 @@ func (f FrameHeader) Channels() int {
 	return 2
 }
 
-func (f FrameHeader) ModeExtension() string {
+func (f FrameHeader) ModeExtension() ModeExtension {
 	if f.ChannelMode() != CHANNEL_MODE_JOINT_STEREO {
 		return MODE_EXTENSION_NA
 	}
-	modeExtension := modeExtensionMask.Decode(f)
-	switch f.layer() {
-	case 1:
-		fallthrough
-	case 2:
-		switch modeExtension {
-		case 0:
-			return MODE_EXTENSION_BANDS_4_31
-		case 1:
-			return MODE_EXTENSION_BANDS_8_31
-		case 2:
-			return MODE_EXTENSION_BANDS_12_31
-		case 3:
-			return MODE_EXTENSION_BANDS_16_31
-		}
-	case 3:
-		switch modeExtension {
-		case 0:
-			return MODE_EXTENSION_NONE
-		case 1:
-			return MODE_EXTENSION_INTENSITY_STEREO
-		case 2:
-			return MODE_EXTENSION_M_S_STEREO
-		case 3:
-			return MODE_EXTENSION_INTENSITY_M_S_STEREO
-		}
+	modeExtension := ModeExtension(modeExtensionMask.Decode(f))
+	if f.layer() == 3 {
+		return MODE_EXTENSION_NONE + modeExtension
 	}
-	panic("Invalid mode extension in frame header")
+	return MODE_EXTENSION_BANDS_4_31 + modeExtension
 }
 
 func (f FrameHeader) Copyrighted() bool {
@@ -443,33 +519,57 @@ func (f FrameHeader) Original() bool {
 	return originalMask.Decode(f) == 1
 }
 
-func (f FrameHeader) Emphasis() string {
-	switch emphasisMask.Decode(f) {
-	case 0:
-		return EMPHASIS_NONE
-	case 1:
-		return EMPHASIS__50_15_MS
-	case 3:
-		return EMPHASIS_CCITT_J_17
+func (f FrameHeader) Emphasis() Emphasis {
+	emphasis := Emphasis(emphasisMask.Decode(f))
+	if _, ok := emphasisNames[emphasis]; !ok {
+		panic("Invalid emphasis in frame header")
 	}
-	panic("Invalid emphasis in frame header")
+	return emphasis
 }
 
-// TODO: verify if the calculations are ok, or should we use int64
+// LengthInBytes returns the length of the frame, including the header,
+// or 0 for free format frames.
 func (f FrameHeader) LengthInBytes() int {
-	pad := uint32(0)
-	if f.Padding() {
-		pad = 1
+	if f.FreeFormat() {
+		return 0
 	}
-	var length int
+	return f.lengthInSlots(f.unpaddedSlots()) * f.slotSize()
+}
+
+// Frames are made of slots: 4 bytes long in Layer I, 1 byte long in
+// Layers II and III.
+func (f FrameHeader) slotSize() int {
 	if f.layer() == 1 {
-		length = int(48000*uint32(f.BitrateInKbps())/f.SampleRate() + pad*4)
-	} else {
-		length = int(144000*uint32(f.BitrateInKbps())/f.SampleRate() + pad)
+		return 4
 	}
-	return length
+	return 1
 }
 
+// slotsPerKbps returns the number of slots in an unpadded frame, times the
+// sample rate, for each kbps of bitrate.
+func (f FrameHeader) slotsPerKbps() uint32 {
+	switch {
+	case f.layer() == 1:
+		return 12000
+	case f.layer() == 3 && f.Version() != MPEG_VERSION_1_0:
+		return 72000
+	}
+	return 144000
+}
+
+func (f FrameHeader) unpaddedSlots() int {
+	return int(f.slotsPerKbps() * uint32(f.BitrateInKbps()) / f.SampleRate())
+}
+
+func (f FrameHeader) lengthInSlots(unpaddedSlots int) int {
+	if f.Padding() {
+		return unpaddedSlots + 1
+	}
+	return unpaddedSlots
+}
+
+// SideInfoStart returns the offset of the side information in the frame,
+// after the header and the CRC if there is one.
 func (f FrameHeader) SideInfoStart() int {
 	if f.Protection() {
 		return 6
@@ -498,3 +598,10 @@ func (f FrameHeader) SideInfoEnd() int {
 func unpackInteger(b4 []byte) int32 {
 	return int32(b4[0])<<24 + int32(b4[1])<<16 + int32(b4[2])<<8 + int32(b4[3])
 }
+
+func packInteger(b4 []byte, v uint32) {
+	b4[0] = byte(v >> 24)
+	b4[1] = byte(v >> 16)
+	b4[2] = byte(v >> 8)
+	b4[3] = byte(v)
+}
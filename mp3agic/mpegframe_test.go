@@ -0,0 +1,129 @@
+package mp3agic_test
+
+import (
+	"mp3agic"
+	. "testing"
+)
+
+func frameHeader(t *T, b0, b1, b2, b3 byte) *mp3agic.FrameHeader {
+	frame, err := mp3agic.NewFrameHeader([]byte{b0, b1, b2, b3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestFrameLengths(t *T) {
+	tests := []struct {
+		header      []byte
+		layer       mp3agic.MpegLayer
+		version     mp3agic.MpegVersion
+		bitrate     int
+		length      int
+		paddedDelta int
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x44}, mp3agic.MPEG_LAYER_3, mp3agic.MPEG_VERSION_1_0, 128, 417, 1},
+		{[]byte{0xff, 0xf3, 0x80, 0xc4}, mp3agic.MPEG_LAYER_3, mp3agic.MPEG_VERSION_2_0, 64, 208, 1},
+		{[]byte{0xff, 0xe3, 0x80, 0xc4}, mp3agic.MPEG_LAYER_3, mp3agic.MPEG_VERSION_2_5, 64, 417, 1},
+		{[]byte{0xff, 0xfd, 0xa4, 0x04}, mp3agic.MPEG_LAYER_2, mp3agic.MPEG_VERSION_1_0, 192, 576, 1},
+		{[]byte{0xff, 0xf5, 0x80, 0x04}, mp3agic.MPEG_LAYER_2, mp3agic.MPEG_VERSION_2_0, 64, 417, 1},
+		{[]byte{0xff, 0xff, 0xc0, 0x04}, mp3agic.MPEG_LAYER_1, mp3agic.MPEG_VERSION_1_0, 384, 416, 4},
+		{[]byte{0xff, 0xff, 0x10, 0x04}, mp3agic.MPEG_LAYER_1, mp3agic.MPEG_VERSION_1_0, 32, 32, 4},
+		{[]byte{0xff, 0xf7, 0x80, 0x04}, mp3agic.MPEG_LAYER_1, mp3agic.MPEG_VERSION_2_0, 128, 276, 4}}
+	for i, test := range tests {
+		h := test.header
+		frame := frameHeader(t, h[0], h[1], h[2], h[3])
+		assertEq(t, test.layer, frame.Layer(), "layer", i)
+		assertEq(t, test.version, frame.Version(), "version", i)
+		assertEq(t, test.bitrate, frame.BitrateInKbps(), "bitrate", i)
+		assertEq(t, test.length, frame.LengthInBytes(), "length", i)
+		padded := frameHeader(t, h[0], h[1], h[2]|0x02, h[3])
+		assertEq(t, test.length+test.paddedDelta, padded.LengthInBytes(), "padded length", i)
+	}
+}
+
+func TestFrameHeaderFields(t *T) {
+	frame := frameHeader(t, 0xff, 0xfb, 0x90, 0x64)
+	assertEq(t, mp3agic.MPEG_VERSION_1_0, frame.Version(), "version")
+	assertEq(t, "1.0", frame.Version().String(), "version")
+	assertEq(t, 3, int(frame.Layer()), "layer")
+	assertEq(t, "III", frame.Layer().String(), "layer")
+	assertEq(t, mp3agic.CHANNEL_MODE_JOINT_STEREO, frame.ChannelMode(), "channel mode")
+	assertEq(t, "Joint stereo", frame.ChannelMode().String(), "channel mode")
+	assertEq(t, mp3agic.MODE_EXTENSION_M_S_STEREO, frame.ModeExtension(), "mode extension")
+	assertEq(t, 2, frame.ModeExtension().Bits(), "mode extension bits")
+	assertEq(t, "M/S stereo", frame.ModeExtension().String(), "mode extension")
+	assertEq(t, mp3agic.EMPHASIS_NONE, frame.Emphasis(), "emphasis")
+	assertEq(t, "None", frame.Emphasis().String(), "emphasis")
+
+	frame = frameHeader(t, 0xff, 0xfd, 0xa4, 0x55)
+	assertEq(t, mp3agic.MODE_EXTENSION_BANDS_8_31, frame.ModeExtension(), "mode extension")
+	assertEq(t, 1, frame.ModeExtension().Bits(), "mode extension bits")
+	assertEq(t, mp3agic.EMPHASIS__50_15_MS, frame.Emphasis(), "emphasis")
+	assertEq(t, "Invalid", mp3agic.MpegVersion(1).String(), "reserved version")
+}
+
+func TestFrameHeaderProtection(t *T) {
+	frame := frameHeader(t, 0xff, 0xfb, 0x90, 0x64) // protection bit set
+	assert(t, !frame.Protection(), "unprotected frame")
+	assertEq(t, 4, frame.SideInfoStart(), "side info start")
+	frame = frameHeader(t, 0xff, 0xfa, 0x90, 0x64)
+	assert(t, frame.Protection(), "protected frame")
+	assertEq(t, 6, frame.SideInfoStart(), "side info start")
+	assertEq(t, 38, frame.SideInfoEnd(), "side info end")
+}
+
+func TestFreeFormatFrameHeader(t *T) {
+	frame := frameHeader(t, 0xff, 0xfb, 0x00, 0x44)
+	assert(t, frame.FreeFormat(), "free format")
+	assertEq(t, 0, frame.BitrateInKbps(), "bitrate")
+	assertEq(t, 0, frame.LengthInBytes(), "length")
+	assert(t, !frameHeader(t, 0xff, 0xfb, 0x90, 0x44).FreeFormat(), "free format")
+}
+
+func TestParseFreeFormatStream(t *T) {
+	for _, bufferLength := range []int{0, 1024, 256, 41} { // frames are about 500 bytes long
+		file, err := loadMp3(t, "freeformat.mp3", bufferLength)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		assertEq(t, 6, file.FrameCount(), "frame count", bufferLength)
+		assertEq(t, int64(0), file.StartOffset(), "start offset", bufferLength)
+		assertEq(t, int64(3000), file.EndOffset(), "end offset", bufferLength)
+		assertEq(t, 153, file.Bitrate(), "bitrate", bufferLength)
+		assertEq(t, mp3agic.MPEG_LAYER_3, file.Layer(), "layer", bufferLength)
+	}
+	file, err := streamMp3(t, "freeformat.mp3", 1024)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assertEq(t, 6, file.FrameCount(), "stream frame count")
+	assertEq(t, int64(3000), file.EndOffset(), "stream end offset")
+}
+
+func TestParseLayer1And2Streams(t *T) {
+	tests := []struct {
+		filename   string
+		layer      mp3agic.MpegLayer
+		frameCount int
+		endOffset  int64
+		bitrate    int
+		length     int64 // in milliseconds
+	}{
+		{"layer2.mp2", mp3agic.MPEG_LAYER_2, 5, 2879, 192, 120},
+		{"layer1.mp1", mp3agic.MPEG_LAYER_1, 5, 2087, 384, 43}}
+	for _, test := range tests {
+		file, err := loadMp3(t, test.filename, 0)
+		if err != nil {
+			t.Error(test.filename, err)
+			continue
+		}
+		assertEq(t, test.layer, file.Layer(), test.filename, "layer")
+		assertEq(t, test.frameCount, file.FrameCount(), test.filename, "frame count")
+		assertEq(t, test.endOffset, file.EndOffset(), test.filename, "end offset")
+		assertEq(t, test.bitrate, file.Bitrate(), test.filename, "bitrate")
+		assertEq(t, test.length, file.Duration()/1e6, test.filename, "duration")
+	}
+}
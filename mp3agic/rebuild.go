@@ -0,0 +1,235 @@
+package mp3agic
+
+import (
+	"io"
+	"mp3agic/id3v2"
+	"os"
+)
+
+// RebuildSummary tells what Rebuild changed in the stream.
+type RebuildSummary struct {
+	Frames          int   // number of audio frames written
+	DroppedFrames   int   // damaged or truncated frames left out
+	JunkBytes       int64 // bytes of junk left out, including dropped frames
+	DuplicateTags   int   // duplicated ID3v2 tags left out
+	XingRegenerated bool  // the Xing/Info (or VBRI) header was rebuilt
+	XingAdded       bool  // a Xing/Info frame was added, see AddXingFrame
+	LameTagAdded    bool  // a LAME tag was made from an iTunSMPB comment
+}
+
+// RebuildOptions tune how a stream is rebuilt. A nil *RebuildOptions
+// selects the defaults.
+type RebuildOptions struct {
+	// AddXingFrame inserts a Xing (VBR) or Info (CBR) frame before the
+	// audio frames of Layer III streams which have none, so that players
+	// can tell their duration and seek in them. It only holds a LAME tag
+	// if the encoder delay and padding are known from an iTunSMPB comment:
+	// most streams get none, as made up values would make players drop
+	// or keep the wrong samples.
+	AddXingFrame bool
+}
+
+// Rebuild writes a cleaned copy of the stream read from r to w: the ID3v2
+// tag, a regenerated Xing/Info frame if the stream had one (a VBRI header
+// is replaced with a Xing header), the audio frames found while scanning,
+// the custom tag and the ID3v1 tag. Junk, damaged frames and duplicated
+// ID3v2 tags are left out. The file must have been parsed with both
+// ParseOptions.IndexFrames and ParseOptions.Diagnostics.
+func (f *File) Rebuild(r io.ReaderAt, w io.Writer, opts *RebuildOptions) (*RebuildSummary, os.Error) {
+	if f.frames == nil || !f.diagnostics {
+		return nil, os.NewError("Rebuild needs the frame index and diagnostics")
+	}
+	summary := &RebuildSummary{Frames: len(f.frames)}
+	keepCustomTag := f.customTag != nil
+	for _, issue := range f.issues {
+		switch issue.Kind {
+		case ISSUE_DUPLICATE_TAG:
+			summary.DuplicateTags++
+		case ISSUE_JUNK, ISSUE_LOST_SYNC, ISSUE_INCONSISTENT_HEADER:
+			if issue.Kind == ISSUE_INCONSISTENT_HEADER {
+				summary.DroppedFrames++
+			}
+			if issue.Offset <= f.endOffset { // else it is the custom tag
+				summary.JunkBytes += issue.Length
+			}
+		case ISSUE_TRUNCATED_FRAME:
+			summary.DroppedFrames++
+			summary.JunkBytes += issue.Length
+			keepCustomTag = false // it is the truncated frame
+		}
+	}
+
+	buf := make([]byte, DEFAULT_BUFFER_LENGTH)
+	header, _ := id3v2.ExtractTagHeader(r)
+	if header != nil {
+		err := copyRange(w, r, 0, int64(header.TagLength()), buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	addXing := opts != nil && opts.AddXingFrame
+	if f.layer == MPEG_LAYER_3 && (f.xingOffset >= 0 || addXing) {
+		frame, err := f.rebuildXingFrame(r, buf, addXing)
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(frame)
+		if err != nil {
+			return nil, err
+		}
+		summary.XingRegenerated = f.xingOffset >= 0
+		summary.XingAdded = !summary.XingRegenerated
+		summary.LameTagAdded = f.lameTag == nil && addXing && f.newLameTag() != nil
+	}
+	for _, frame := range f.frames {
+		err := copyRange(w, r, frame.Offset, int64(frame.Length), buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if keepCustomTag {
+		_, err := w.Write(f.customTag)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if f.id3v1tag != nil {
+		err := copyRange(w, r, f.length-Id3v1_length, Id3v1_length, buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// rebuildXingFrame builds a Xing/Info frame for the indexed frames, with a
+// LAME tag if the stream had one, or if newLameTag is set and one can be
+// made.
+func (f *File) rebuildXingFrame(r io.ReaderAt, buf []byte, newLameTag bool) ([]byte, os.Error) {
+	header := XingFrameHeader(f.frames[0].Header, f.Bitrate())
+	x := &XingHeader{
+		Id:      "Info",
+		Flags:   XING_FLAG_FRAMES | XING_FLAG_BYTES | XING_FLAG_TOC | XING_FLAG_QUALITY,
+		Frames:  uint32(len(f.frames)),
+		Quality: 100}
+	if f.Vbr() {
+		x.Id = "Xing"
+	}
+	if f.xingHeader != nil && f.xingHeader.HasQuality() {
+		x.Quality = f.xingHeader.Quality
+	}
+
+	// offsets of the frames in the rebuilt stream, from the Xing frame
+	length := int64(header.LengthInBytes())
+	offsets := make([]int64, len(f.frames))
+	for i, frame := range f.frames {
+		offsets[i] = length
+		length += int64(frame.Length)
+	}
+	x.Bytes = uint32(length)
+	for i := range x.Toc {
+		position := offsets[i*len(offsets)/XING_TOC_LENGTH] * 256 / length
+		if position > 255 {
+			position = 255
+		}
+		x.Toc[i] = byte(position)
+	}
+
+	var tag *LameTag
+	if f.lameTag != nil {
+		copied := *f.lameTag
+		tag = &copied
+	} else if newLameTag {
+		tag = f.newLameTag()
+	}
+	if tag != nil {
+		tag.MusicLength = x.Bytes
+		tag.MusicCrc = 0
+		for _, frame := range f.frames {
+			chunk := buf[:frame.Length]
+			if frame.Length > len(buf) {
+				chunk = make([]byte, frame.Length)
+			}
+			readn, err := r.ReadAt(chunk, frame.Offset)
+			if readn < len(chunk) {
+				return nil, readError(err)
+			}
+			tag.MusicCrc = lameCrc16(tag.MusicCrc, chunk)
+		}
+	}
+	return NewXingFrame(header, x, tag)
+}
+
+// newLameTag returns a LAME tag describing the stream, for a stream which
+// has none. The encoder delay and padding are taken from the iTunSMPB
+// comment; nil is returned if there is none, as the tag would otherwise
+// claim that there are no padding samples.
+func (f *File) newLameTag() *LameTag {
+	if f.id3v2tag == nil {
+		return nil
+	}
+	delay, padding, _, ok := parseItunSmpb(f.id3v2tag.CommentByDescription("iTunSMPB"))
+	if !ok || delay > 0xfff || padding > 0xfff {
+		return nil
+	}
+	tag := &LameTag{
+		Encoder:        "LAME",
+		VbrMethod:      LAME_VBR_UNKNOWN,
+		Bitrate:        f.Bitrate(),
+		StereoMode:     LAME_STEREO_STEREO,
+		EncoderDelay:   int(delay),
+		EncoderPadding: int(padding)}
+	if !f.Vbr() {
+		tag.VbrMethod = LAME_VBR_CBR
+	}
+	if tag.Bitrate > 255 {
+		tag.Bitrate = 255
+	}
+	switch f.channelMode {
+	case CHANNEL_MODE_MONO:
+		tag.StereoMode = LAME_STEREO_MONO
+	case CHANNEL_MODE_DUAL_MONO:
+		tag.StereoMode = LAME_STEREO_DUAL
+	case CHANNEL_MODE_JOINT_STEREO:
+		tag.StereoMode = LAME_STEREO_JOINT
+	}
+	switch {
+	case f.sampleRate <= 32000:
+		tag.SourceSampleRate = 0
+	case f.sampleRate == 44100:
+		tag.SourceSampleRate = 1
+	case f.sampleRate == 48000:
+		tag.SourceSampleRate = 2
+	default:
+		tag.SourceSampleRate = 3
+	}
+	return tag
+}
+
+// copyRange copies length bytes, found at offset in r, to w.
+func copyRange(w io.Writer, r io.ReaderAt, offset, length int64, buf []byte) os.Error {
+	for length > 0 {
+		chunk := buf
+		if int64(len(chunk)) > length {
+			chunk = chunk[:length]
+		}
+		readn, err := r.ReadAt(chunk, offset)
+		if readn < len(chunk) {
+			return readError(err)
+		}
+		_, err = w.Write(chunk)
+		if err != nil {
+			return err
+		}
+		offset += int64(readn)
+		length -= int64(readn)
+	}
+	return nil
+}
+
+func readError(err os.Error) os.Error {
+	if err == nil || err == os.EOF {
+		return os.NewError("Unexpected end of stream")
+	}
+	return err
+}
@@ -0,0 +1,198 @@
+package mp3agic_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mp3agic"
+	. "testing"
+)
+
+var repairOptions = &mp3agic.ParseOptions{IndexFrames: true, Diagnostics: true}
+
+func rebuildMp3(t *T, data []byte) (*mp3agic.RebuildSummary, []byte, *mp3agic.File) {
+	return rebuildMp3WithOptions(t, data, nil)
+}
+
+func rebuildMp3WithOptions(t *T, data []byte, opts *mp3agic.RebuildOptions) (*mp3agic.RebuildSummary, []byte, *mp3agic.File) {
+	file, err := mp3agic.Parse(BufReaderAt(data), int64(len(data)), repairOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	summary, err := file.Rebuild(BufReaderAt(data), &out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := mp3agic.Parse(BufReaderAt(out.Bytes()), int64(out.Len()),
+		&mp3agic.ParseOptions{IndexFrames: true, Diagnostics: true, VerifyMusicCrc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary, out.Bytes(), rebuilt
+}
+
+func readTestFile(t *T, filename string) []byte {
+	data, err := ioutil.ReadFile(RES_DIR + filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRebuildDamagedFile(t *T) {
+	data := readTestFile(t, "damaged.mp3")
+	summary, out, file := rebuildMp3(t, data)
+	assertEq(t, 5, summary.Frames, "frames")
+	assertEq(t, 1, summary.DroppedFrames, "dropped frames")
+	assertEq(t, int64(726), summary.JunkBytes, "junk bytes")
+	assert(t, summary.XingRegenerated, "xing regenerated")
+
+	assertEq(t, 0, len(file.Issues()), "issues")
+	assertEq(t, 5, file.FrameCount(), "frame count")
+	x := file.XingHeader()
+	assert(t, x != nil, "xing header")
+	if x != nil {
+		assertEq(t, uint32(5), x.Frames, "xing frames")
+		assertEq(t, uint32(len(out)), x.Bytes, "xing bytes")
+		for i := 1; i < len(x.Toc); i++ {
+			assert(t, x.Toc[i-1] <= x.Toc[i], "toc out of order", i)
+		}
+	}
+	tag := file.LameTag()
+	assert(t, tag != nil, "lame tag")
+	if tag != nil {
+		assert(t, tag.TagCrcValid(), "tag crc valid")
+		assert(t, tag.MusicCrcValid(), "music crc valid")
+		assertEq(t, 576, tag.EncoderDelay, "encoder delay")
+	}
+
+	// the audio frames are copied as they are
+	original, _ := mp3agic.Parse(BufReaderAt(data), int64(len(data)), repairOptions)
+	for i, frame := range file.Frames() {
+		source := original.Frames()[i]
+		assertEq(t, data[source.Offset:source.Offset+int64(source.Length)],
+			out[frame.Offset:frame.Offset+int64(frame.Length)], "frame", i)
+	}
+}
+
+func TestRebuildKeepsTags(t *T) {
+	data := readTestFile(t, "v1andv23tags.mp3")
+	summary, out, file := rebuildMp3(t, data)
+	assertEq(t, 0, summary.DroppedFrames, "dropped frames")
+	assertEq(t, int64(0), summary.JunkBytes, "junk bytes")
+	assertEq(t, data[:0x44b], out[:0x44b], "id3v2 tag")
+	assertEq(t, data[len(data)-128:], out[len(out)-128:], "id3v1 tag")
+	assert(t, file.HasId3v1Tag(), "has id3v1 tag")
+	assert(t, file.HasId3v2Tag(), "has id3v2 tag")
+	assertEq(t, int64(0x44b), file.XingOffset(), "xing offset")
+	assertEq(t, 4410, int(file.SampleCount()), "sample count")
+}
+
+func TestRebuildKeepsTagFooter(t *T) {
+	data := readTestFile(t, "v24tagwithfooter.mp3")
+	const tagLength = 43 // with the 10 byte footer
+	summary, out, file := rebuildMp3(t, data)
+	assertEq(t, int64(0), summary.JunkBytes, "junk bytes")
+	assertEq(t, data[:tagLength], out[:tagLength], "id3v2 tag")
+	assertEq(t, 0, len(file.Issues()), "issues")
+	assertEq(t, int64(tagLength), file.XingOffset(), "xing offset")
+	assert(t, file.HasId3v2Tag(), "has id3v2 tag")
+	if file.HasId3v2Tag() {
+		assertEq(t, tagLength, file.Id3v2Tag().Length(), "id3v2 tag length")
+		assertEq(t, "Footer title", file.Id3v2Tag().Title(), "title")
+	}
+
+	duplicated := append(append([]byte{}, data[:tagLength]...), data...)
+	summary, out, _ = rebuildMp3(t, duplicated)
+	assertEq(t, 1, summary.DuplicateTags, "duplicate tags")
+	_, expected, _ := rebuildMp3(t, data)
+	assertEq(t, expected, out, "rebuilt data")
+}
+
+func TestRebuildRemovesDuplicateTags(t *T) {
+	data := readTestFile(t, "v1andv23tags.mp3")
+	duplicated := append(append([]byte{}, data[:0x44b]...), data...)
+	summary, out, file := rebuildMp3(t, duplicated)
+	assertEq(t, 1, summary.DuplicateTags, "duplicate tags")
+	assertEq(t, 0, len(file.Issues()), "issues")
+	_, expected, _ := rebuildMp3(t, data)
+	assertEq(t, expected, out, "rebuilt data")
+}
+
+func TestRebuildDropsTruncatedFrame(t *T) {
+	data := readTestFile(t, "incompletempegframe.mp3")
+	summary, _, file := rebuildMp3(t, data)
+	assertEq(t, 1, summary.DroppedFrames, "dropped frames")
+	assertEq(t, 5, file.FrameCount(), "frame count")
+	assertEq(t, 0, len(file.Issues()), "issues")
+	assert(t, !file.HasCustomTag(), "has custom tag")
+	assert(t, file.HasId3v1Tag(), "has id3v1 tag")
+}
+
+func TestRebuildNeedsIndexAndDiagnostics(t *T) {
+	file, err := loadMp3(t, "notags.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	_, err = file.Rebuild(BufReaderAt(nil), &bytes.Buffer{}, nil)
+	assert(t, err != nil, "err should be non nil")
+}
+
+func TestRebuildAddsXingFrame(t *T) {
+	data := readTestFile(t, "notags.mp3")[0x1a1:] // without the Xing frame
+	summary, _, file := rebuildMp3(t, data)
+	assert(t, !summary.XingAdded, "xing added")
+	assert(t, !file.HasXingFrame(), "has xing frame")
+
+	summary, out, file := rebuildMp3WithOptions(t, data, &mp3agic.RebuildOptions{AddXingFrame: true})
+	assert(t, summary.XingAdded, "xing added")
+	assert(t, !summary.XingRegenerated, "xing regenerated")
+	assertEq(t, int64(0), file.XingOffset(), "xing offset")
+	assertEq(t, data, out[file.StartOffset():], "audio frames")
+	x := file.XingHeader()
+	assert(t, x != nil, "xing header")
+	if x != nil {
+		assertEq(t, "Xing", x.Id, "xing id")
+		assertEq(t, uint32(6), x.Frames, "xing frames")
+		assertEq(t, uint32(len(out)), x.Bytes, "xing bytes")
+	}
+	// the encoder delay and padding are not known
+	assert(t, !summary.LameTagAdded, "lame tag added")
+	assert(t, file.LameTag() == nil, "lame tag")
+	assertEq(t, mp3agic.GAPLESS_INFO_NONE, file.GaplessInfo(), "gapless info")
+	assertEq(t, int64(6912), file.SampleCount(), "sample count")
+}
+
+func TestRebuildAddsXingFrameWithoutItunSmpb(t *T) {
+	data := readTestFile(t, "v1andv23tags.mp3")
+	data = append(append([]byte{}, data[:0x44b]...), data[0x5ec:]...) // without the Xing frame
+	summary, _, file := rebuildMp3WithOptions(t, data, &mp3agic.RebuildOptions{AddXingFrame: true})
+	assert(t, summary.XingAdded, "xing added")
+	assert(t, !summary.LameTagAdded, "lame tag added")
+	assert(t, file.HasId3v2Tag(), "has id3v2 tag")
+	assertEq(t, int64(0x44b), file.XingOffset(), "xing offset")
+	assert(t, file.XingHeader() != nil, "xing header")
+	assert(t, file.LameTag() == nil, "lame tag")
+	assertEq(t, mp3agic.GAPLESS_INFO_NONE, file.GaplessInfo(), "gapless info")
+}
+
+func TestRebuildReplacesVbriFrame(t *T) {
+	data := readTestFile(t, "itunsmpb.mp3")
+	summary, _, file := rebuildMp3WithOptions(t, data, &mp3agic.RebuildOptions{AddXingFrame: true})
+	assert(t, summary.XingRegenerated, "xing regenerated")
+	assert(t, summary.LameTagAdded, "lame tag added")
+	assert(t, file.VbriHeader() == nil, "vbri header")
+	assert(t, file.XingHeader() != nil, "xing header")
+	tag := file.LameTag()
+	assert(t, tag != nil, "lame tag")
+	if tag != nil {
+		assertEq(t, "LAME", tag.Encoder, "encoder")
+		assertEq(t, 0x210, tag.EncoderDelay, "encoder delay")
+		assertEq(t, 0x340, tag.EncoderPadding, "encoder padding")
+		assert(t, tag.TagCrcValid(), "tag crc valid")
+		assert(t, tag.MusicCrcValid(), "music crc valid")
+	}
+	assertEq(t, int64(5552), file.SampleCount(), "sample count")
+	assertEq(t, mp3agic.GAPLESS_INFO_LAME, file.GaplessInfo(), "gapless info")
+}
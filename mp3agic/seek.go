@@ -0,0 +1,181 @@
+package mp3agic
+
+// OffsetForTime returns the offset of the audio frame playing at time d,
+// in nanoseconds from the start of the audio. The offset is exact if the
+// frames were indexed (see ParseOptions.IndexFrames); otherwise it is
+// estimated from the TOC of the Xing or VBRI header, or assuming a
+// constant bitrate. Times past the end of the audio map to EndOffset()+1.
+func (f *File) OffsetForTime(d int64) (offset int64, exact bool) {
+	if d < 0 {
+		d = 0
+	}
+	sample := f.timeToSamples(d)
+	if f.frames != nil {
+		i := f.frameAtSample(sample)
+		if i < 0 {
+			return f.endOffset + 1, true
+		}
+		return f.frames[i].Offset, true
+	}
+	total := f.totalSamples()
+	if total <= 0 || sample >= total {
+		return f.endOffset + 1, false
+	}
+	fraction := float64(sample) / float64(total)
+
+	if f.xingHeader != nil && f.xingHeader.HasToc() {
+		percent := fraction * 100
+		i := int(percent)
+		a, b := float64(f.xingHeader.Toc[i]), 256.0
+		if i < XING_TOC_LENGTH-1 {
+			b = float64(f.xingHeader.Toc[i+1])
+		}
+		position := a + (b-a)*(percent-float64(i))
+		offset = f.xingOffset + int64(position/256*float64(f.xingBytes()))
+		if offset < f.startOffset {
+			offset = f.startOffset // the TOC starts with the Xing frame
+		}
+		return offset, false
+	}
+	if f.vbriHeader != nil && f.vbriHeader.TocFramesPerEntry > 0 {
+		entrySamples := int64(f.vbriHeader.TocFramesPerEntry) * int64(f.samplesPerFrame)
+		offset = f.startOffset
+		for i := range f.vbriHeader.Toc {
+			if sample < entrySamples {
+				fraction = float64(sample) / float64(entrySamples)
+				return offset + int64(fraction*float64(f.vbriHeader.TocBytes(i))), false
+			}
+			sample -= entrySamples
+			offset += f.vbriHeader.TocBytes(i)
+		}
+		return f.endOffset + 1, false
+	}
+	return f.startOffset + int64(fraction*float64(f.endOffset+1-f.startOffset)), false
+}
+
+// TimeForOffset returns the time, in nanoseconds from the start of the
+// audio, at which the byte at the given offset is played. Like
+// OffsetForTime, the result is only exact if the frames were indexed.
+func (f *File) TimeForOffset(offset int64) (d int64, exact bool) {
+	if f.sampleRate == 0 {
+		return 0, false
+	}
+	total := f.totalSamples()
+	if f.frames != nil {
+		i := f.frameAtOffset(offset)
+		switch {
+		case i < 0:
+			return 0, true
+		case offset > f.endOffset:
+			return f.samplesToTime(total), true
+		}
+		return f.frames[i].Timestamp(), true
+	}
+	if offset < f.startOffset || total <= 0 {
+		return 0, false
+	}
+	if offset > f.endOffset {
+		return f.samplesToTime(total), false
+	}
+
+	fraction := float64(offset-f.startOffset) / float64(f.endOffset+1-f.startOffset)
+	if f.xingHeader != nil && f.xingHeader.HasToc() {
+		position := float64(offset-f.xingOffset) * 256 / float64(f.xingBytes())
+		fraction = 1
+		for i := 0; i < XING_TOC_LENGTH; i++ {
+			a, b := float64(f.xingHeader.Toc[i]), 256.0
+			if i < XING_TOC_LENGTH-1 {
+				b = float64(f.xingHeader.Toc[i+1])
+			}
+			if position < b {
+				if b > a {
+					fraction = (float64(i) + (position-a)/(b-a)) / 100
+				} else {
+					fraction = float64(i) / 100
+				}
+				break
+			}
+		}
+	} else if f.vbriHeader != nil && f.vbriHeader.TocFramesPerEntry > 0 {
+		entrySamples := int64(f.vbriHeader.TocFramesPerEntry) * int64(f.samplesPerFrame)
+		start := f.startOffset
+		sample := int64(0)
+		for i := range f.vbriHeader.Toc {
+			length := f.vbriHeader.TocBytes(i)
+			if offset < start+length {
+				sample += int64(float64(offset-start) / float64(length) * float64(entrySamples))
+				break
+			}
+			start += length
+			sample += entrySamples
+		}
+		fraction = float64(sample) / float64(total)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	return f.samplesToTime(int64(fraction * float64(total))), false
+}
+
+// totalSamples returns the number of samples in all audio frames,
+// including the encoder delay and padding.
+func (f *File) totalSamples() int64 {
+	return int64(f.frameCount) * int64(f.samplesPerFrame)
+}
+
+func (f *File) samplesToTime(samples int64) int64 {
+	return samples * 1e9 / int64(f.sampleRate)
+}
+
+// timeToSamples converts d, in nanoseconds, to a number of samples. d is
+// split in whole seconds first, so that the product does not overflow.
+func (f *File) timeToSamples(d int64) int64 {
+	rate := int64(f.sampleRate)
+	return d/1e9*rate + d%1e9*rate/1e9
+}
+
+// xingBytes returns the length of the MPEG data described by the Xing
+// header, starting with the Xing frame.
+func (f *File) xingBytes() int64 {
+	if f.xingHeader.HasBytes() {
+		return int64(f.xingHeader.Bytes)
+	}
+	return f.endOffset + 1 - f.xingOffset
+}
+
+// frameAtSample returns the index of the indexed frame holding the given
+// sample, or -1 if it is past the last frame.
+func (f *File) frameAtSample(sample int64) int {
+	lo, hi := 0, len(f.frames)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if f.frames[mid].FirstSample <= sample {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return 0
+	}
+	last := &f.frames[lo-1]
+	if lo == len(f.frames) && sample >= last.FirstSample+int64(last.Header.SamplesPerFrame()) {
+		return -1
+	}
+	return lo - 1
+}
+
+// frameAtOffset returns the index of the last indexed frame starting at
+// or before offset, or -1 if there is none.
+func (f *File) frameAtOffset(offset int64) int {
+	lo, hi := 0, len(f.frames)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if f.frames[mid].Offset <= offset {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo - 1
+}
@@ -0,0 +1,80 @@
+package mp3agic_test
+
+import (
+	"mp3agic"
+	. "testing"
+)
+
+// start times of the frames of notags.mp3, in nanoseconds
+var frameTimes = []int64{0, 26122448, 52244897, 78367346, 104489795, 130612244}
+var frameOffsets = []int64{0x1a1, 0x47c, 0x5e9, 0x722, 0x85b, 0xacd}
+
+func TestSeekWithFrameIndex(t *T) {
+	file, err := mp3agic.ParseFile(RES_DIR+"notags.mp3", &mp3agic.ParseOptions{IndexFrames: true})
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	for i, frameTime := range frameTimes {
+		offset, exact := file.OffsetForTime(frameTime + 1000)
+		assertEq(t, frameOffsets[i], offset, "offset", i)
+		assert(t, exact, "offset should be exact", i)
+		d, exact := file.TimeForOffset(frameOffsets[i] + 10)
+		assertEq(t, frameTime, d, "time", i)
+		assert(t, exact, "time should be exact", i)
+	}
+	offset, _ := file.OffsetForTime(-1)
+	assertEq(t, int64(0x1a1), offset, "offset before start")
+	offset, _ = file.OffsetForTime(1e9)
+	assertEq(t, int64(0xb35), offset, "offset past end")
+	offset, _ = file.OffsetForTime(100 * 3600e9) // overflows if multiplied by the sample rate
+	assertEq(t, int64(0xb35), offset, "offset far past end")
+	d, _ := file.TimeForOffset(0)
+	assertEq(t, int64(0), d, "time before start")
+	d, _ = file.TimeForOffset(0xb35)
+	assertEq(t, int64(156734693), d, "time past end")
+}
+
+func TestSeekEstimates(t *T) {
+	for _, filename := range []string{"notags.mp3", "vbri.mp3", "v1andv23andcustomtags.mp3"} {
+		file, err := loadMp3(t, filename, 0)
+		if err != nil {
+			t.Error(filename, err)
+			continue
+		}
+		offset, exact := file.OffsetForTime(0)
+		assertEq(t, file.StartOffset(), offset, filename, "offset of start")
+		assert(t, !exact, filename, "offset should be estimated")
+		offset, _ = file.OffsetForTime(1e9)
+		assertEq(t, file.EndOffset()+1, offset, filename, "offset past end")
+		offset, _ = file.OffsetForTime(100 * 3600e9)
+		assertEq(t, file.EndOffset()+1, offset, filename, "offset far past end")
+
+		last := file.StartOffset()
+		for i := range frameTimes {
+			offset, _ = file.OffsetForTime(frameTimes[i])
+			assert(t, offset >= last && offset <= file.EndOffset(), filename, "offset out of order", i, offset)
+			last = offset
+			d, exact := file.TimeForOffset(offset)
+			assert(t, !exact, filename, "time should be estimated", i)
+			assert(t, d >= frameTimes[i]-26122449 && d <= frameTimes[i]+26122449, filename, "time too far off", i, d)
+		}
+	}
+}
+
+func TestSeekWithVbriToc(t *T) {
+	file, err := loadMp3(t, "vbri.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	// each TOC entry covers two frames
+	start := file.StartOffset()
+	for i, length := range []int64{1096, 626, 730} {
+		offset, _ := file.OffsetForTime(frameTimes[2*i] + 1)
+		assertEq(t, start, offset, "offset of TOC entry", i)
+		d, _ := file.TimeForOffset(start)
+		assertEq(t, frameTimes[2*i], d, "time of TOC entry", i)
+		start += length
+	}
+}
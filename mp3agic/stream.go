@@ -0,0 +1,254 @@
+package mp3agic
+
+import (
+	"io"
+	"mp3agic/id3v2"
+	"os"
+)
+
+// streamWindow keeps the most recently read part of a non-seekable stream
+// in memory. All offsets are absolute positions in the stream.
+type streamWindow struct {
+	r     io.Reader
+	buf   []byte
+	start int64 // stream offset of buf[0]
+	n     int   // number of valid bytes in buf
+	eof   bool
+}
+
+func (w *streamWindow) end() int64 {
+	return w.start + int64(w.n)
+}
+
+// fill reads from the stream until the window is full or the stream ends.
+func (w *streamWindow) fill() os.Error {
+	for !w.eof && w.n < len(w.buf) {
+		readn, err := w.r.Read(w.buf[w.n:])
+		w.n += readn
+		if err == os.EOF {
+			w.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard drops the bytes before the given stream offset from the window.
+func (w *streamWindow) discard(offset int64) {
+	k := int(offset - w.start)
+	if k <= 0 {
+		return
+	}
+	if k > w.n {
+		k = w.n
+	}
+	copy(w.buf, w.buf[k:w.n])
+	w.n -= k
+	w.start += int64(k)
+}
+
+// grow makes room in the window for more data.
+func (w *streamWindow) grow() {
+	buf := make([]byte, 2*len(w.buf))
+	copy(buf, w.buf[:w.n])
+	w.buf = buf
+}
+
+// ReadAt reads from the part of the stream still kept in the window.
+func (w *streamWindow) ReadAt(p []byte, off int64) (int, os.Error) {
+	if off < w.start || off >= w.end() {
+		return 0, os.EOF
+	}
+	readn := copy(p, w.buf[off-w.start:w.n])
+	if readn < len(p) {
+		return readn, os.EOF
+	}
+	return readn, nil
+}
+
+// ParseStream parses an MP3 stream in a single pass, without seeking, so
+// that it can be used on pipes and network connections. Apart from the
+// tags, only about opts.BufferLength bytes of the stream are kept in
+// memory, or the length of the longest frame if it is longer; the last
+// Id3v1_length bytes read are always kept, so that the ID3v1 tag can still
+// be found when the stream ends. Once scanning stops, at the end of the
+// MPEG frames or at a damaged frame, up to MAXIMUM_STREAM_TAIL_LENGTH bytes
+// are kept for the custom tag: if more follow, there is no custom tag and
+// a warning is recorded.
+// ParseOptions.VerifyMusicCrc and ParseOptions.Diagnostics are ignored:
+// scanning stops at the first damaged frame, as with Parse by default.
+func ParseStream(r io.Reader, opts *ParseOptions) (*File, os.Error) {
+	bufferLength := opts.bufferLength()
+	if bufferLength <= MINIMUM_BUFFER_LENGTH {
+		return nil, os.NewError("Buffer too small")
+	}
+	mp3file := &File{
+		length:      -1,
+		startOffset: -1,
+		endOffset:   -1,
+		xingOffset:  -1,
+		indexFrames: opts.indexFrames(),
+		bitrates:    make(map[int]int)}
+	w := &streamWindow{r: r, buf: make([]byte, bufferLength+Id3v1_length)}
+
+	offset, err := mp3file.streamId3v2Tag(w)
+	if err != nil {
+		return nil, err
+	}
+	err = mp3file.streamFrames(w, offset)
+	if err != nil {
+		return nil, err
+	}
+	if mp3file.startOffset < 0 {
+		return nil, &InvalidDataError{-1, "No mpegs frames found"}
+	}
+	if w.start > mp3file.endOffset+1 {
+		mp3file.addWarning(&InvalidDataError{mp3file.endOffset + 1, "Data after the MPEG frames too long to be kept as custom tag"})
+	} else {
+		mp3file.addWarning(mp3file.extractCustomTag(w))
+	}
+
+	return mp3file, nil
+}
+
+// streamId3v2Tag reads the ID3v2 tag at the start of the stream, if there
+// is one, and returns the offset of the first byte after it.
+func (f *File) streamId3v2Tag(w *streamWindow) (int64, os.Error) {
+	err := w.fill()
+	if err != nil {
+		return 0, err
+	}
+	header, err := id3v2.ExtractTagHeader(w)
+	if err != nil {
+		f.addWarning(err)
+		return 0, nil
+	}
+
+	length := header.TagLength()
+	for w.n < length && !w.eof {
+		w.grow()
+		err = w.fill()
+		if err != nil {
+			return 0, err
+		}
+	}
+	f.id3v2tag, err = id3v2.ExtractTag(w)
+	f.addWarning(err)
+	return int64(length), nil
+}
+
+// streamFrames runs the scanBlockForStart/scanBlock logic over the stream.
+// Until the stream ends, the last Id3v1_length bytes read are not allowed
+// to become part of any frame, as they may yet turn out to be the ID3v1
+// tag.
+func (f *File) streamFrames(w *streamWindow, offset int64) os.Error {
+	stalled := false
+	xingPending := false  // Xing/VBRI frame found, but not decoded yet
+	xingDone := int64(-1) // offset of the last one decoded
+	for {
+		keep := f.keepFrom(offset)
+		if xingPending && f.xingOffset < keep {
+			keep = f.xingOffset
+		}
+		w.discard(keep)
+		if stalled && w.n == len(w.buf) {
+			w.grow() // a frame does not fit in the window
+		}
+		err := w.fill()
+		if err != nil {
+			return err
+		}
+		end := w.end()
+		if !w.eof {
+			f.scanLimit = end - Id3v1_length
+			end = f.scanLimit + MINIMUM_BUFFER_LENGTH
+		} else if f.length < 0 {
+			f.streamEnd(w)
+		}
+		if xingPending {
+			err = f.extractVbrHeader(w)
+			if err != os.EOF || w.eof {
+				f.addWarning(err)
+				xingPending = false
+				xingDone = f.xingOffset
+			}
+		}
+
+		readn := int(end - offset)
+		if readn < MINIMUM_BUFFER_LENGTH {
+			if w.eof {
+				return nil
+			}
+			stalled = true
+			continue
+		}
+
+		next, err := f.scanStep(w, w.buf[offset-w.start:w.n], readn, offset)
+		if err != nil {
+			// in Java mp3agic was: "catch(InvalidDataException)"
+			if f.frameCount >= 2 {
+				if f.xingOffset >= 0 && f.xingOffset != xingDone {
+					f.addWarning(f.extractVbrHeader(w))
+				}
+				break
+			}
+			offset, err = f.resync(err)
+			if err != nil {
+				return err
+			}
+			stalled = false
+			xingPending = false
+			continue
+		}
+		if f.xingOffset >= 0 && f.xingOffset != xingDone {
+			xingPending = true
+		}
+		stalled = next == offset
+		if stalled && w.eof {
+			return nil
+		}
+		offset = next
+	}
+
+	// end of MPEG frames; keep whatever follows them, for the custom tag,
+	// unless it is too long: only the last bytes are kept then, for the
+	// ID3v1 tag
+	if f.endOffset+1 < offset {
+		offset = f.endOffset + 1
+	}
+	w.discard(offset)
+	for !w.eof {
+		if w.n == len(w.buf) && len(w.buf) < MAXIMUM_STREAM_TAIL_LENGTH {
+			w.grow()
+		} else if w.n == len(w.buf) {
+			w.discard(w.end() - Id3v1_length)
+		}
+		err := w.fill()
+		if err != nil {
+			return err
+		}
+	}
+	if f.length < 0 {
+		f.streamEnd(w)
+	}
+	return nil
+}
+
+// keepFrom returns the offset of the first byte that may still be needed
+// once scanning resumes at the given offset.
+func (f *File) keepFrom(offset int64) int64 {
+	if f.startOffset >= 0 && f.frameCount < 2 && f.startOffset+1 < offset {
+		return f.startOffset + 1 // scanning may need to resync
+	}
+	return offset
+}
+
+// streamEnd records the length of the stream and its ID3v1 tag, once the
+// end of the stream has been reached.
+func (f *File) streamEnd(w *streamWindow) {
+	f.length = w.end()
+	var err os.Error
+	f.id3v1tag, err = ExtractId3v1Tag(w, f.length)
+	f.addWarning(err)
+}
@@ -0,0 +1,118 @@
+package mp3agic_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mp3agic"
+	"os"
+	. "testing"
+)
+
+// onlyReader hides all methods of the wrapped reader except Read, like a
+// pipe would.
+type onlyReader struct {
+	r *bytes.Buffer
+}
+
+func (r onlyReader) Read(p []byte) (int, os.Error) {
+	return r.r.Read(p)
+}
+
+func streamMp3(t *T, filename string, bufferLength int) (*mp3agic.File, os.Error) {
+	return streamMp3WithOptions(t, filename, &mp3agic.ParseOptions{BufferLength: bufferLength})
+}
+
+func streamMp3WithOptions(t *T, filename string, opts *mp3agic.ParseOptions) (*mp3agic.File, os.Error) {
+	data, err := ioutil.ReadFile(RES_DIR + filename)
+	if err != nil {
+		t.Fatal(err)
+		return nil, err
+	}
+	return mp3agic.ParseStream(onlyReader{bytes.NewBuffer(data)}, opts)
+}
+
+func TestStreamMatchesParse(t *T) {
+	filenames := []string{
+		"notags.mp3",
+		"v1andv23tags.mp3",
+		"dummyframes.mp3",
+		"v1andv23andcustomtags.mp3",
+		"incompletempegframe.mp3",
+		"v1andv23tagswithalbumimage.mp3"}
+	for _, filename := range filenames {
+		for _, bufferLength := range []int{0, 41, 256, 1024, 5000} {
+			expected, err := loadMp3(t, filename, bufferLength)
+			if err != nil {
+				t.Error(filename, err)
+				continue
+			}
+			file, err := streamMp3(t, filename, bufferLength)
+			if err != nil {
+				t.Error(filename, bufferLength, err)
+				continue
+			}
+			msg := func(s string) string {
+				return filename + ": " + s
+			}
+			assertEq(t, expected.Length(), file.Length(), msg("length"), bufferLength)
+			assertEq(t, expected.XingOffset(), file.XingOffset(), msg("xing offset"), bufferLength)
+			assertEq(t, expected.StartOffset(), file.StartOffset(), msg("start offset"), bufferLength)
+			assertEq(t, expected.EndOffset(), file.EndOffset(), msg("end offset"), bufferLength)
+			assertEq(t, expected.FrameCount(), file.FrameCount(), msg("frame count"), bufferLength)
+			assertEq(t, expected.Bitrates(), file.Bitrates(), msg("bitrates"), bufferLength)
+			assertEq(t, expected.Id3v1Tag(), file.Id3v1Tag(), msg("id3v1 tag"), bufferLength)
+			assertEq(t, expected.CustomTag(), file.CustomTag(), msg("custom tag"), bufferLength)
+			assertEq(t, expected.HasId3v2Tag(), file.HasId3v2Tag(), msg("has id3v2 tag"), bufferLength)
+			if file.HasId3v2Tag() {
+				assertEq(t, expected.Id3v2Tag().Title(), file.Id3v2Tag().Title(), msg("id3v2 title"), bufferLength)
+			}
+		}
+	}
+}
+
+// readLengthReader records the longest read from the wrapped reader.
+type readLengthReader struct {
+	r       *bytes.Buffer
+	longest int
+}
+
+func (r *readLengthReader) Read(p []byte) (int, os.Error) {
+	if len(p) > r.longest {
+		r.longest = len(p)
+	}
+	return r.r.Read(p)
+}
+
+func TestStreamBufferBoundedAfterDamagedFrame(t *T) {
+	data, err := ioutil.ReadFile(RES_DIR + "v1andv23tags.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := loadMp3(t, "v1andv23tags.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a megabyte of junk after three audio frames, before the ID3v1 tag
+	damage := expected.StartOffset() + 3*417
+	junk := bytes.Repeat([]byte("JUNK"), 1<<18)
+	tail := data[len(data)-mp3agic.Id3v1_length:]
+	damaged := append(append(append([]byte{}, data[:damage]...), junk...), tail...)
+	for _, bufferLength := range []int{0, 256} {
+		r := &readLengthReader{r: bytes.NewBuffer(damaged)}
+		file, err := mp3agic.ParseStream(r, &mp3agic.ParseOptions{BufferLength: bufferLength})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEq(t, 3, file.FrameCount(), "frame count", bufferLength)
+		assertEq(t, int64(len(damaged)), file.Length(), "length", bufferLength)
+		assertEq(t, expected.Id3v1Tag(), file.Id3v1Tag(), "id3v1 tag", bufferLength)
+		assert(t, file.CustomTag() == nil, "custom tag", bufferLength)
+		assertEq(t, 1, len(file.Warnings()), "warnings", bufferLength)
+		assert(t, r.longest <= 2*mp3agic.MAXIMUM_STREAM_TAIL_LENGTH, "buffer grew to", r.longest, bufferLength)
+	}
+}
+
+func TestStreamErrorForFileThatIsNotAnMp3(t *T) {
+	_, err := streamMp3(t, "notanmp3.mp3", 0)
+	assert(t, err != nil, "err should be non nil")
+}
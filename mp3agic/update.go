@@ -0,0 +1,139 @@
+package mp3agic
+
+import (
+	"bufio"
+	"io/ioutil"
+	"mp3agic/id3v2"
+	"os"
+	"path"
+)
+
+const (
+	DEFAULT_TAG_PADDING = 2048 // bytes of padding after a rewritten ID3v2 tag
+)
+
+// UpdateTags replaces the ID3v1 and ID3v2 tags of the named file, a nil
+// tag removing it. The ID3v2 tag is written in its own version, and the
+// extended "TAG+" block which may precede the ID3v1 tag is removed.
+//
+// If the new ID3v2 tag fits in the existing one and its padding, it is
+// overwritten in place. Otherwise the audio data, from the first MPEG
+// frame (the Xing/Info or VBRI frame if there is one), is copied after the new tag and DEFAULT_TAG_PADDING bytes of
+// padding to a temporary file, which then replaces the original one: the
+// original file is left untouched if anything fails.
+//
+// Both tags are built, and the file read, before anything is written.
+// Still the in-place update is not atomic: if writing fails, e.g. because
+// of an I/O error or a crash, the ID3v2 tag may be written without the
+// ID3v1 tag being updated, or either tag may be partly written.
+func UpdateTags(filename string, v1 *Id3v1Tag, v2 *id3v2.Tag) os.Error {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(filename, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mp3file, err := Parse(f, stat.Size, nil)
+	if err != nil {
+		return err
+	}
+	id3v1length, err := id3v1Length(f, stat.Size)
+	if err != nil {
+		return err
+	}
+	var tag []byte
+	if v2 != nil {
+		tag, err = v2.Bytes(v2.MajorVersion(), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	room := 0 // length of the existing ID3v2 tag
+	if header, _ := id3v2.ExtractTagHeader(f); header != nil {
+		room = header.TagLength()
+		if int64(room) > mp3file.firstFrameOffset() {
+			room = 0 // damaged, the audio data must not be overwritten
+		}
+	}
+	switch {
+	case v2 == nil && room == 0:
+	case v2 != nil && len(tag) <= room:
+		tag, err = v2.Bytes(v2.MajorVersion(), &id3v2.WriteOptions{Padding: room - len(tag)})
+		if err != nil {
+			return err
+		}
+	default:
+		return mp3file.rewriteTags(f, filename, stat.Mode&0777, id3v1length, v1, v2)
+	}
+
+	if tag != nil {
+		_, err = f.WriteAt(tag, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return writeId3v1Tag(f, stat.Size, id3v1length, v1)
+}
+
+// rewriteTags writes the audio data read from r, up to the ID3v1 tag of the
+// given length, with the given tags to a temporary file which then
+// replaces the named file.
+func (f *File) rewriteTags(r *os.File, filename string, mode uint32, id3v1length int64, v1 *Id3v1Tag, v2 *id3v2.Tag) os.Error {
+	dir, name := path.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, name+".")
+	if err != nil {
+		return err
+	}
+	err = f.writeTagged(tmp, r, id3v1length, v1, v2)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (f *File) writeTagged(out *os.File, r *os.File, id3v1length int64, v1 *Id3v1Tag, v2 *id3v2.Tag) os.Error {
+	w := bufio.NewWriter(out)
+	if v2 != nil {
+		tag, err := v2.Bytes(v2.MajorVersion(), &id3v2.WriteOptions{Padding: DEFAULT_TAG_PADDING})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(tag)
+		if err != nil {
+			return err
+		}
+	}
+	start, end := f.firstFrameOffset(), f.length-id3v1length
+	err := copyRange(w, r, start, end-start, make([]byte, DEFAULT_BUFFER_LENGTH))
+	if err != nil {
+		return err
+	}
+	if v1 != nil {
+		_, err = w.Write(v1[:])
+		if err != nil {
+			return err
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+	return out.Sync()
+}
@@ -0,0 +1,130 @@
+package mp3agic_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mp3agic"
+	"mp3agic/id3v2"
+	"os"
+	. "testing"
+)
+
+// copyTestFile copies a test file to a temporary file, whose name is
+// returned.
+func copyTestFile(t *T, filename string) string {
+	data, err := ioutil.ReadFile(RES_DIR + filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "mp3agic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write(data)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+// audioData returns the bytes of the named file from its first MPEG
+// frame, the Xing frame if there is one, without the ID3v1 tag.
+func audioData(t *T, filename string) []byte {
+	mp3file, err := mp3agic.ParseFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mp3file.HasId3v1Tag() {
+		data = data[:len(data)-mp3agic.Id3v1_length]
+	}
+	start := mp3file.StartOffset()
+	if mp3file.HasXingFrame() {
+		start = mp3file.XingOffset()
+	}
+	return data[start:]
+}
+
+func TestUpdateTagsInPlace(t *T) {
+	filename := copyTestFile(t, "v1andv23tags.mp3")
+	defer os.Remove(filename)
+	audio := audioData(t, filename)
+	mp3file, err := mp3agic.ParseFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mp3file.Id3v2Tag()
+	tag.SetTitle("Short title")
+	err = mp3agic.UpdateTags(filename, mp3file.Id3v1Tag(), tag)
+	assertEq(t, nil, err, "error")
+
+	updated, err := mp3agic.ParseFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(t, mp3file.Length(), updated.Length(), "length")
+	assertEq(t, mp3file.StartOffset(), updated.StartOffset(), "start offset")
+	assertEq(t, mp3file.XingOffset(), updated.XingOffset(), "xing offset")
+	assertEq(t, "Short title", updated.Id3v2Tag().Title(), "title")
+	assertEq(t, tag.Artist(), updated.Id3v2Tag().Artist(), "artist")
+	assertEq(t, true, updated.HasId3v1Tag(), "ID3v1 tag")
+	assertEq(t, true, bytes.Equal(audio, audioData(t, filename)), "audio data unchanged")
+
+	err = mp3agic.UpdateTags(filename, nil, updated.Id3v2Tag())
+	assertEq(t, nil, err, "error")
+	updated, err = mp3agic.ParseFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEq(t, mp3file.Length()-mp3agic.Id3v1_length, updated.Length(), "length without ID3v1 tag")
+	assertEq(t, false, updated.HasId3v1Tag(), "ID3v1 tag")
+}
+
+func TestUpdateTagsRewritesFile(t *T) {
+	filename := copyTestFile(t, "v1andv23tags.mp3")
+	defer os.Remove(filename)
+	audio := audioData(t, filename)
+	image, err := ioutil.ReadFile(RES_DIR + "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp3file, err := mp3agic.ParseFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mp3file.Id3v2Tag()
+	tag.SetAlbumImage(image, "image/png")
+	err = mp3agic.UpdateTags(filename, mp3file.Id3v1Tag(), tag)
+	assertEq(t, nil, err, "error")
+
+	updated, err := mp3agic.ParseFile(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	length := int64(updated.Id3v2Tag().Length())
+	assertEq(t, length, updated.XingOffset(), "xing offset")
+	assertEq(t, mp3file.StartOffset()-mp3file.XingOffset(), updated.StartOffset()-length, "xing frame length")
+	assert(t, updated.XingHeader() != nil, "xing header expected")
+	assertEq(t, mp3file.FrameCount(), updated.FrameCount(), "frame count")
+	assertEq(t, true, updated.Id3v2Tag().DataLength() > len(image)+mp3agic.DEFAULT_TAG_PADDING, "padding expected")
+	assertEq(t, true, bytes.Equal(image, updated.Id3v2Tag().AlbumImage()), "album image")
+	assertEq(t, tag.Title(), updated.Id3v2Tag().Title(), "title")
+	assertEq(t, mp3file.Id3v1Tag().Title(), updated.Id3v1Tag().Title(), "ID3v1 title")
+	assertEq(t, true, bytes.Equal(audio, audioData(t, filename)), "audio data unchanged")
+
+	// ID3v2.2 tags cannot be written
+	obsolete, err := mp3agic.ParseFile(RES_DIR+"obselete.mp3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := ioutil.ReadFile(filename)
+	err = mp3agic.UpdateTags(filename, nil, obsolete.Id3v2Tag())
+	_, ok := err.(*id3v2.UnsupportedTagError)
+	assertEq(t, true, ok, "UnsupportedTagError expected")
+	after, _ := ioutil.ReadFile(filename)
+	assertEq(t, true, bytes.Equal(before, after), "file unchanged")
+}
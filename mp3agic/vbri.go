@@ -0,0 +1,92 @@
+package mp3agic
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	vbri_magic  = "VBRI"
+	vbri_offset = 36
+)
+
+// VbriHeader is the VBR header stored by Fraunhofer encoders in an
+// otherwise silent MPEG frame before the audio frames, instead of a Xing
+// header.
+type VbriHeader struct {
+	Version uint16
+	Delay   uint16
+	Quality uint16
+	Bytes   uint32 // length of the MPEG data
+	Frames  uint32 // number of MPEG frames
+
+	// Toc holds the length in bytes of consecutive sections of the
+	// stream, each TocFramesPerEntry frames long, divided by TocScale.
+	Toc               []uint32
+	TocScale          uint16
+	TocEntrySize      uint16 // in bytes, 1 to 4
+	TocFramesPerEntry uint16
+}
+
+func HasVbriFrameTag(buf []byte) bool {
+	return len(buf) >= vbri_offset+len(vbri_magic) &&
+		string(buf[vbri_offset:vbri_offset+len(vbri_magic)]) == vbri_magic
+}
+
+// NewVbriHeader decodes the VBRI header from frame, which must contain a
+// whole MPEG frame.
+func NewVbriHeader(frame []byte) (*VbriHeader, os.Error) {
+	if !HasVbriFrameTag(frame) {
+		return nil, os.NewError("VBRI header not found")
+	}
+	offset := vbri_offset + len(vbri_magic)
+	truncated := func() os.Error {
+		return os.NewError(fmt.Sprintf("VBRI header truncated at frame offset %d", offset))
+	}
+	if len(frame) < offset+22 {
+		return nil, truncated()
+	}
+	v := &VbriHeader{
+		Version:           unpackUint16(frame[offset:]),
+		Delay:             unpackUint16(frame[offset+2:]),
+		Quality:           unpackUint16(frame[offset+4:]),
+		Bytes:             uint32(unpackInteger(frame[offset+6 : offset+10])),
+		Frames:            uint32(unpackInteger(frame[offset+10 : offset+14])),
+		Toc:               make([]uint32, unpackUint16(frame[offset+14:])),
+		TocScale:          unpackUint16(frame[offset+16:]),
+		TocEntrySize:      unpackUint16(frame[offset+18:]),
+		TocFramesPerEntry: unpackUint16(frame[offset+20:])}
+	offset += 22
+
+	size := int(v.TocEntrySize)
+	if size < 1 || size > 4 {
+		return nil, os.NewError(fmt.Sprintf("invalid VBRI TOC entry size %d", size))
+	}
+	if len(frame) < offset+len(v.Toc)*size {
+		return nil, truncated()
+	}
+	for i := range v.Toc {
+		entry := uint32(0)
+		for _, b := range frame[offset : offset+size] {
+			entry = entry<<8 | uint32(b)
+		}
+		v.Toc[i] = entry
+		offset += size
+	}
+	return v, nil
+}
+
+// TocBytes returns the length in bytes of the i-th section of the stream
+// described by the TOC.
+func (v *VbriHeader) TocBytes(i int) int64 {
+	return int64(v.Toc[i]) * int64(v.TocScale)
+}
+
+func unpackUint16(b2 []byte) uint16 {
+	return uint16(b2[0])<<8 | uint16(b2[1])
+}
+
+func packUint16(b2 []byte, v uint16) {
+	b2[0] = byte(v >> 8)
+	b2[1] = byte(v)
+}
@@ -0,0 +1,52 @@
+package mp3agic_test
+
+import (
+	. "testing"
+)
+
+func TestDecodeVbriHeader(t *T) {
+	for _, bufferLength := range []int{0, 41, 256, 1024, 5000} {
+		file, err := loadMp3(t, "vbri.mp3", bufferLength)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		assert(t, file.HasXingFrame(), "has xing frame")
+		assert(t, file.XingHeader() == nil, "unexpected Xing header")
+		assertEq(t, int64(0x000), file.XingOffset(), "xing offset")
+		assertEq(t, int64(0x1a1), file.StartOffset(), "start offset")
+		assertEq(t, 6, file.FrameCount(), "frame count")
+		assertEq(t, 125, file.Bitrate(), "file bitrate")
+
+		vbri := file.VbriHeader()
+		if vbri == nil {
+			t.Fatal("no VBRI header")
+			return
+		}
+		assertEq(t, uint16(1), vbri.Version, "version")
+		assertEq(t, uint16(1105), vbri.Delay, "delay")
+		assertEq(t, uint16(75), vbri.Quality, "quality")
+		assertEq(t, uint32(2869), vbri.Bytes, "bytes")
+		assertEq(t, uint32(6), vbri.Frames, "frames")
+		assertEq(t, []uint32{548, 313, 365}, vbri.Toc, "toc")
+		assertEq(t, uint16(2), vbri.TocScale, "toc scale")
+		assertEq(t, uint16(2), vbri.TocEntrySize, "toc entry size")
+		assertEq(t, uint16(2), vbri.TocFramesPerEntry, "toc frames per entry")
+		assertEq(t, int64(1096), vbri.TocBytes(0), "toc bytes")
+	}
+}
+
+func TestDecodeVbriHeaderFromStream(t *T) {
+	file, err := streamMp3(t, "vbri.mp3", 41)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	vbri := file.VbriHeader()
+	if vbri == nil {
+		t.Fatal("no VBRI header")
+		return
+	}
+	assertEq(t, uint32(6), vbri.Frames, "frames")
+	assertEq(t, 3, len(vbri.Toc), "toc length")
+}
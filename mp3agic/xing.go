@@ -0,0 +1,196 @@
+package mp3agic
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	XING_FLAG_FRAMES  = 0x0001
+	XING_FLAG_BYTES   = 0x0002
+	XING_FLAG_TOC     = 0x0004
+	XING_FLAG_QUALITY = 0x0008
+
+	XING_TOC_LENGTH = 100
+)
+
+// XingHeader is the Xing (VBR) or Info (CBR) header, stored by most
+// encoders in an otherwise silent MPEG frame before the audio frames.
+type XingHeader struct {
+	Id      string // "Xing" or "Info"
+	Flags   uint32
+	Frames  uint32 // number of audio frames, not counting the Xing frame
+	Bytes   uint32 // length of the MPEG data, including the Xing frame
+	Toc     [XING_TOC_LENGTH]byte
+	Quality uint32 // 0 (best) - 100 (worst)
+
+	// offset of the first byte after the Xing header, relative to the
+	// start of the MPEG frame; the LAME tag starts there
+	end int
+}
+
+func probeXing(buf []byte, offset int) bool {
+	if len(buf) < offset+4 {
+		return false
+	}
+	probe := string(buf[offset : offset+4])
+	return probe == "Xing" || probe == "Info"
+}
+
+func xingTagOffset(buf []byte) int {
+	for _, offset := range []int{13, 21, 36} {
+		if probeXing(buf, offset) {
+			return offset
+		}
+	}
+	return -1
+}
+
+func HasXingFrameTag(buf []byte) bool {
+	return xingTagOffset(buf) >= 0
+}
+
+// NewXingHeader decodes the Xing header from frame, which must contain a
+// whole MPEG frame.
+func NewXingHeader(frame []byte) (*XingHeader, os.Error) {
+	offset := xingTagOffset(frame)
+	if offset < 0 {
+		return nil, os.NewError("Xing header not found")
+	}
+	x := &XingHeader{Id: string(frame[offset : offset+4])}
+	offset += 4
+
+	next := func(length int) ([]byte, os.Error) {
+		if offset+length > len(frame) {
+			return nil, os.NewError(fmt.Sprintf("Xing header truncated at frame offset %d", offset))
+		}
+		field := frame[offset : offset+length]
+		offset += length
+		return field, nil
+	}
+
+	field, err := next(4)
+	if err != nil {
+		return nil, err
+	}
+	x.Flags = uint32(unpackInteger(field))
+	if x.Flags&XING_FLAG_FRAMES != 0 {
+		if field, err = next(4); err != nil {
+			return nil, err
+		}
+		x.Frames = uint32(unpackInteger(field))
+	}
+	if x.Flags&XING_FLAG_BYTES != 0 {
+		if field, err = next(4); err != nil {
+			return nil, err
+		}
+		x.Bytes = uint32(unpackInteger(field))
+	}
+	if x.Flags&XING_FLAG_TOC != 0 {
+		if field, err = next(XING_TOC_LENGTH); err != nil {
+			return nil, err
+		}
+		copy(x.Toc[:], field)
+	}
+	if x.Flags&XING_FLAG_QUALITY != 0 {
+		if field, err = next(4); err != nil {
+			return nil, err
+		}
+		x.Quality = uint32(unpackInteger(field))
+	}
+	x.end = offset
+	return x, nil
+}
+
+// Vbr tells if the header was written for a variable bitrate stream.
+func (x *XingHeader) Vbr() bool {
+	return x.Id == "Xing"
+}
+
+func (x *XingHeader) HasFrames() bool {
+	return x.Flags&XING_FLAG_FRAMES != 0
+}
+
+func (x *XingHeader) HasBytes() bool {
+	return x.Flags&XING_FLAG_BYTES != 0
+}
+
+func (x *XingHeader) HasToc() bool {
+	return x.Flags&XING_FLAG_TOC != 0
+}
+
+func (x *XingHeader) HasQuality() bool {
+	return x.Flags&XING_FLAG_QUALITY != 0
+}
+
+// XingFrameHeader returns the header for a frame holding a Xing header
+// and a LAME tag, ahead of audio frames like the given one. Its bitrate is
+// the one closest to kbps which leaves enough room in the frame.
+func XingFrameHeader(like FrameHeader, kbps int) FrameHeader {
+	base := like&^0xf200 | 0x10000 // no bitrate, padding or CRC
+	best, bestDistance := base|0xe000, -1
+	for i := 1; i < 15; i++ {
+		header := base | FrameHeader(i<<12)
+		if header.LengthInBytes() < xingFrameLength(header) {
+			continue
+		}
+		distance := header.BitrateInKbps() - kbps
+		if distance < 0 {
+			distance = -distance
+		}
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = header, distance
+		}
+	}
+	return best
+}
+
+// xingFrameLength returns the length of a frame holding a complete Xing
+// header and a LAME tag.
+func xingFrameLength(header FrameHeader) int {
+	return header.SideInfoEnd() + 4 + 4 + 4 + 4 + XING_TOC_LENGTH + 4 + LAME_TAG_LENGTH
+}
+
+// NewXingFrame builds a silent Layer III frame with the given header,
+// holding x and, unless it is nil, tag. The fields of x are written as
+// selected by x.Flags; tag.TagCrc is updated.
+func NewXingFrame(header FrameHeader, x *XingHeader, tag *LameTag) ([]byte, os.Error) {
+	if header.Layer() != MPEG_LAYER_3 {
+		return nil, os.NewError("Xing frames are only supported for Layer III")
+	}
+	frame := make([]byte, header.LengthInBytes())
+	if len(frame) < xingFrameLength(header) {
+		return nil, os.NewError("Frame too short for a Xing header")
+	}
+	packInteger(frame, uint32(header))
+	offset := header.SideInfoEnd()
+	next := func(length int) []byte {
+		field := frame[offset : offset+length]
+		offset += length
+		return field
+	}
+
+	copy(next(4), x.Id)
+	packInteger(next(4), x.Flags)
+	if x.HasFrames() {
+		packInteger(next(4), x.Frames)
+	}
+	if x.HasBytes() {
+		packInteger(next(4), x.Bytes)
+	}
+	if x.HasToc() {
+		copy(next(XING_TOC_LENGTH), x.Toc[:])
+	}
+	if x.HasQuality() {
+		packInteger(next(4), x.Quality)
+	}
+	x.end = offset
+	if tag != nil {
+		buf := next(LAME_TAG_LENGTH)
+		tag.pack(buf)
+		tag.TagCrc = lameCrc16(0, frame[:x.end+34])
+		packUint16(buf[34:], tag.TagCrc)
+		tag.tagCrcValid = true
+	}
+	return frame, nil
+}
@@ -0,0 +1,64 @@
+package mp3agic_test
+
+import (
+	"mp3agic"
+	. "testing"
+)
+
+func TestDecodeXingHeader(t *T) {
+	file, err := loadMp3(t, "v1andv23tags.mp3", 0)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	xing := file.XingHeader()
+	if xing == nil {
+		t.Fatal("no Xing header")
+		return
+	}
+	assertEq(t, "Xing", xing.Id, "id")
+	assert(t, xing.Vbr(), "vbr")
+	assertEq(t, uint32(0x0f), xing.Flags, "flags")
+	assert(t, xing.HasFrames() && xing.HasBytes() && xing.HasToc() && xing.HasQuality(), "has all fields")
+	assertEq(t, uint32(file.FrameCount()), xing.Frames, "frames")
+	assertEq(t, uint32(0xb35), xing.Bytes, "bytes")
+	assertEq(t, byte(0x00), xing.Toc[0], "toc[0]")
+	assertEq(t, byte(0x4c), xing.Toc[1], "toc[1]")
+	assertEq(t, byte(0xff), xing.Toc[99], "toc[99]")
+	assertEq(t, uint32(78), xing.Quality, "quality")
+}
+
+func TestDecodeXingHeaderFromStream(t *T) {
+	for _, bufferLength := range []int{0, 41, 256} {
+		file, err := streamMp3(t, "v1andv23tags.mp3", bufferLength)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		xing := file.XingHeader()
+		if xing == nil {
+			t.Error("no Xing header", bufferLength)
+			continue
+		}
+		assertEq(t, uint32(6), xing.Frames, "frames", bufferLength)
+		assertEq(t, uint32(78), xing.Quality, "quality", bufferLength)
+	}
+}
+
+func TestXingHeaderWithoutOptionalFields(t *T) {
+	frame := make([]byte, 417)
+	copy(frame, "\xff\xfb\x90\x44")
+	copy(frame[36:], "Info\x00\x00\x00\x01\x00\x00\x01\x00")
+	xing, err := mp3agic.NewXingHeader(frame)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	assert(t, !xing.Vbr(), "vbr")
+	assert(t, xing.HasFrames(), "has frames")
+	assert(t, !xing.HasBytes() && !xing.HasToc() && !xing.HasQuality(), "has other fields")
+	assertEq(t, uint32(256), xing.Frames, "frames")
+
+	_, err = mp3agic.NewXingHeader(frame[:42])
+	assert(t, err != nil, "expected error for truncated Xing header")
+}
@@ -14,12 +14,14 @@ const (
 var (
 	mp3file   *mp3agic.File
 	vbrString = map[bool]string{true: "VBR", false: "CBR"}
+	crcString = map[bool]string{true: "CRC OK", false: "CRC BAD"}
 )
 
 func main() {
 	if len(os.Args) < 2 {
 		//TODO: port original usage()
 		fmt.Printf("Usage: %v <FILE.mp3>\n", os.Args[0])
+		fmt.Printf("  use '-' as FILE.mp3 to read from standard input\n")
 		return
 	}
 
@@ -32,25 +34,24 @@ func main() {
 		exitcode = code
 	}
 
-	// TODO: buffer the file
-	file, err := os.Open(os.Args[1], os.O_RDONLY, 0)
-	if err != nil {
-		error(1, err)
-		return
-		//fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		//os.Exit(1)
-	}
-	defer file.Close()
-
 	// TODO: iterate args with wildcards expansion
-	mp3file, err = mp3agic.ParseFile(file, 0)
+	var err os.Error
+	if os.Args[1] == "-" {
+		mp3file, err = mp3agic.ParseStream(os.Stdin, nil)
+	} else {
+		mp3file, err = mp3agic.ParseFile(os.Args[1], nil)
+	}
 	if err != nil {
 		error(2, err)
 		return
 	}
+	for _, warning := range mp3file.Warnings() {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", warning)
+	}
 	dumpMp3Fields()
 	dumpId3Fields()
 	dumpCustomTag()
+	dumpLameTag()
 }
 
 func dumpMp3Fields() {
@@ -58,6 +59,8 @@ func dumpMp3Fields() {
 		mp3file.Filename(),
 		mp3file.Length(),
 		mp3file.LengthInSeconds(),
+		mp3file.SampleCount(),
+		mp3file.GaplessInfo(),
 		mp3file.Version(),
 		mp3file.Layer(),
 		mp3file.SampleRate(),
@@ -113,10 +116,26 @@ func dumpCustomTag() {
 		}
 		txt = string(asciiOnly)
 	}
-	dumpCsvRecord(true,
+	dumpCsvRecord(false,
 		txt)
 }
 
+func dumpLameTag() {
+	lame := mp3file.LameTag()
+	if lame == nil {
+		dumpCsvRecord(true, "", "", "", "", "", "", "")
+		return
+	}
+	dumpCsvRecord(true,
+		lame.Encoder,
+		lame.VbrMethodDescription(),
+		lame.Lowpass,
+		lame.EncoderDelay,
+		lame.EncoderPadding,
+		lame.StereoModeDescription(),
+		crcString[lame.TagCrcValid()])
+}
+
 func dumpCsvRecord(endline bool, args ...interface{}) {
 	for i := 0; i < len(args); i++ {
 		s := fmt.Sprintf("%v", args[i])
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"mp3agic"
+	"os"
+	"path"
+)
+
+var addXing = flag.Bool("addxing", false, "add a Xing/Info frame if there is none, with a LAME tag only if an iTunSMPB comment gives the encoder delay and padding")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Printf("Usage: %v [OPTIONS] <SOURCE.mp3> <DEST.mp3>\n", os.Args[0])
+		fmt.Printf("  writes a cleaned copy of SOURCE.mp3 to DEST.mp3\n")
+		fmt.Printf("OPTIONS:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		return
+	}
+
+	exitcode := int(0)
+	defer func() {
+		os.Exit(exitcode)
+	}()
+	error := func(code int, err os.Error) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		exitcode = code
+	}
+
+	src, dst := flag.Arg(0), flag.Arg(1)
+	mp3file, err := mp3agic.ParseFile(src, &mp3agic.ParseOptions{IndexFrames: true, Diagnostics: true})
+	if err != nil {
+		error(2, err)
+		return
+	}
+	in, err := os.Open(src, os.O_RDONLY, 0)
+	if err != nil {
+		error(3, err)
+		return
+	}
+	defer in.Close()
+	// written to a temporary file, renamed once complete: DEST.mp3 may be
+	// SOURCE.mp3
+	mode := uint32(0644)
+	if stat, err := os.Stat(dst); err == nil {
+		mode = stat.Mode & 0777
+	}
+	dir, name := path.Split(dst)
+	if dir == "" {
+		dir = "."
+	}
+	out, err := ioutil.TempFile(dir, name+".")
+	if err != nil {
+		error(3, err)
+		return
+	}
+	w := bufio.NewWriter(out)
+	summary, err := mp3file.Rebuild(in, w, &mp3agic.RebuildOptions{AddXingFrame: *addXing})
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		error(4, err)
+		return
+	}
+
+	for _, issue := range mp3file.Issues() {
+		fmt.Printf("%v\n", issue)
+	}
+	fmt.Printf("%d frames written, %d damaged frames dropped, %d bytes of junk removed\n",
+		summary.Frames, summary.DroppedFrames, summary.JunkBytes)
+	if summary.DuplicateTags > 0 {
+		fmt.Printf("%d duplicated ID3v2 tags removed\n", summary.DuplicateTags)
+	}
+	if summary.XingRegenerated {
+		fmt.Printf("Xing/Info header regenerated\n")
+	}
+	if summary.XingAdded {
+		fmt.Printf("Xing/Info header added\n")
+	}
+	if summary.LameTagAdded {
+		fmt.Printf("LAME tag added from the iTunSMPB comment\n")
+	}
+}